@@ -0,0 +1,263 @@
+package httpsrv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	apachelog "github.com/lestrrat-go/apache-logformat"
+)
+
+// AccessLoggerFormat logs to w when requests come in using the
+// provided apache log format, e.g. `%h "%r" %>s %{X-Request-ID}o`
+func AccessLoggerFormat(w io.Writer, format string) (Middleware, error) {
+	l, err := apachelog.New(format)
+	if err != nil {
+		return nil, err
+	}
+
+	return MiddlewareFunc("access_logger", func(method, path string, h http.Handler) http.Handler {
+		return l.Wrap(h, w)
+	}), nil
+}
+
+// AccessLogConf configures a structured access logger
+type AccessLogConf struct {
+	Writer io.Writer
+	// Logfmt writes logfmt lines instead of json
+	Logfmt bool
+	// SampleRate is the fraction of requests that are logged. Zero
+	// logs every request. Server errors are always logged.
+	SampleRate float64
+	// Identity returns the user making the request. It defaults to
+	// the basic auth username.
+	Identity func(*http.Request) string
+	// RequestIDHeader is read from the response, then the request, for
+	// the request id when the request id middleware runs inside the
+	// access logger. Defaults to RequestIDHeader.
+	RequestIDHeader string
+}
+
+// Middleware returns a Middleware that writes one structured line per
+// request to c.Writer. It shares its ID with AccessLogger so either
+// can be skipped per route with SkipMiddleware(AccessLogger(nil)).
+func (c AccessLogConf) Middleware() Middleware {
+	var mu sync.Mutex
+
+	identity := c.Identity
+	if identity == nil {
+		identity = func(r *http.Request) string {
+			u, _, _ := r.BasicAuth()
+			return u
+		}
+	}
+
+	idHeader := c.RequestIDHeader
+	if idHeader == "" {
+		idHeader = RequestIDHeader
+	}
+
+	return MiddlewareFunc("access_logger", func(method, path string, h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var (
+				start = time.Now()
+				rw    = wrapResponseWriter(w)
+				body  = &countingReader{r: r.Body}
+				entry = &accessLogEntry{}
+			)
+
+			if r.Body != nil {
+				r.Body = body
+			}
+
+			r = r.WithContext(context.WithValue(r.Context(), accessLogKey{}, entry))
+			h.ServeHTTP(rw, r)
+
+			status := rw.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			if c.SampleRate > 0 && c.SampleRate < 1 && status < 500 && rand.Float64() >= c.SampleRate {
+				return
+			}
+
+			fields := []logField{
+				{"time", start.UTC().Format(time.RFC3339Nano)},
+				{"method", r.Method},
+				{"route", path},
+				{"path", r.URL.Path},
+			}
+
+			if ps := httprouter.ParamsFromContext(r.Context()); len(ps) > 0 {
+				m := make(map[string]string, len(ps))
+				for _, p := range ps {
+					m[p.Key] = p.Value
+				}
+				fields = append(fields, logField{"params", m})
+			}
+
+			fields = append(fields,
+				logField{"status", status},
+				logField{"latency_ms", float64(time.Since(start).Microseconds()) / 1000},
+				logField{"bytes_in", body.n},
+				logField{"bytes_out", rw.Written()},
+				logField{"proto", protocol(r)},
+				logField{"remote_addr", r.RemoteAddr},
+				logField{"user_agent", r.UserAgent()},
+			)
+
+			// the context only has the id when the request id middleware
+			// runs first, otherwise it is read from the headers it sets
+			id := RequestIDFromContext(r.Context())
+			if id == "" {
+				id = rw.Header().Get(idHeader)
+			}
+			if id == "" {
+				id = r.Header.Get(idHeader)
+			}
+			if validRequestID(id) {
+				fields = append(fields, logField{"request_id", id})
+			}
+			if u := identity(r); u != "" {
+				fields = append(fields, logField{"user", u})
+			}
+
+			entry.mu.Lock()
+			fields = append(fields, entry.fields...)
+			entry.mu.Unlock()
+
+			var buf bytes.Buffer
+			if c.Logfmt {
+				writeLogfmt(&buf, fields)
+			} else {
+				writeJSONLog(&buf, fields)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			_, _ = buf.WriteTo(c.Writer)
+		})
+	})
+}
+
+type accessLogKey struct{}
+
+type accessLogEntry struct {
+	mu     sync.Mutex
+	fields []logField
+}
+
+// AddAccessLogField adds a field to the structured access log line
+// written for the request ctx belongs to
+func AddAccessLogField(ctx context.Context, key string, value interface{}) {
+	entry, ok := ctx.Value(accessLogKey{}).(*accessLogEntry)
+	if !ok {
+		return
+	}
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	entry.fields = append(entry.fields, logField{key, value})
+}
+
+type logField struct {
+	key   string
+	value interface{}
+}
+
+// protocol returns the protocol of r, distinguishing cleartext
+// http/2 from http/2 over tls
+func protocol(r *http.Request) string {
+	if r.ProtoMajor == 2 {
+		if r.TLS == nil {
+			return "h2c"
+		}
+		return "h2"
+	}
+
+	return r.Proto
+}
+
+func writeJSONLog(buf *bytes.Buffer, fields []logField) {
+	buf.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		k, _ := json.Marshal(f.key)
+		buf.Write(k)
+		buf.WriteByte(':')
+
+		v, err := json.Marshal(f.value)
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprint(f.value))
+		}
+		buf.Write(v)
+	}
+	buf.WriteString("}\n")
+}
+
+func writeLogfmt(buf *bytes.Buffer, fields []logField) {
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+
+		if m, ok := f.value.(map[string]string); ok {
+			for j, k := range sortedStringKeys(m) {
+				if j > 0 {
+					buf.WriteByte(' ')
+				}
+				buf.WriteString(f.key + "." + k + "=" + logfmtValue(m[k]))
+			}
+			continue
+		}
+
+		buf.WriteString(f.key + "=" + logfmtValue(fmt.Sprint(f.value)))
+	}
+	buf.WriteByte('\n')
+}
+
+func logfmtValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func sortedStringKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// countingReader counts the bytes read from a request body
+type countingReader struct {
+	r io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) Close() error {
+	return c.r.Close()
+}
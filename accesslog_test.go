@@ -0,0 +1,148 @@
+package httpsrv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// serveLogged serves r through mws, outermost first, and a handler
+// writing status, returning the json access log line
+func serveLogged(t *testing.T, r *http.Request, status int, mws ...Middleware) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+
+	var (
+		buf bytes.Buffer
+		h   http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		})
+		w = httptest.NewRecorder()
+	)
+
+	mws = append([]Middleware{AccessLogConf{Writer: &buf}.Middleware()}, mws...)
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i].Handler("GET", "/items", h)
+	}
+	h.ServeHTTP(w, r)
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("invalid access log line %q: %s", buf.String(), err)
+	}
+	return w, line
+}
+
+func TestAccessLogRequestIDInside(t *testing.T) {
+	w, line := serveLogged(t, httptest.NewRequest("GET", "/items", nil), http.StatusOK, RequestID)
+
+	id := w.Header().Get(RequestIDHeader)
+	if id == "" || line["request_id"] != id {
+		t.Errorf("expected request_id %q, got %v", id, line["request_id"])
+	}
+}
+
+func TestAccessLogRequestIDIncoming(t *testing.T) {
+	r := httptest.NewRequest("GET", "/items", nil)
+	r.Header.Set(RequestIDHeader, "abc-123")
+
+	if _, line := serveLogged(t, r, http.StatusOK, RequestID); line["request_id"] != "abc-123" {
+		t.Errorf("expected the incoming request_id, got %v", line["request_id"])
+	}
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		mw  = AccessLogConf{Writer: &buf}.Middleware()
+		h   = mw.Handler("POST", "/items/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			AddAccessLogField(r.Context(), "cache", "miss")
+			_, _ = io.Copy(io.Discard, r.Body)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = io.WriteString(w, "created")
+		}))
+		r = httptest.NewRequest("POST", "/items/7", strings.NewReader("body"))
+	)
+
+	r.SetBasicAuth("jo", "secret")
+	r.Header.Set("User-Agent", "test")
+	r.Header.Set(RequestIDHeader, "abc-123")
+	r = r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, httprouter.Params{{Key: "id", Value: "7"}}))
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("invalid json %q: %s", buf.String(), err)
+	}
+
+	for k, v := range map[string]interface{}{
+		"method":      "POST",
+		"route":       "/items/:id",
+		"path":        "/items/7",
+		"params":      map[string]interface{}{"id": "7"},
+		"status":      float64(201),
+		"bytes_in":    float64(4),
+		"bytes_out":   float64(7),
+		"proto":       "HTTP/1.1",
+		"remote_addr": "192.0.2.1:1234",
+		"user_agent":  "test",
+		"request_id":  "abc-123",
+		"user":        "jo",
+		"cache":       "miss",
+	} {
+		if !reflect.DeepEqual(line[k], v) {
+			t.Errorf("expected %s %v, got %v", k, v, line[k])
+		}
+	}
+
+	if _, ok := line["latency_ms"].(float64); !ok {
+		t.Errorf("expected a numeric latency_ms, got %v", line["latency_ms"])
+	}
+	if _, err := time.Parse(time.RFC3339Nano, fmt.Sprint(line["time"])); err != nil {
+		t.Errorf("unexpected time %v", line["time"])
+	}
+}
+
+func TestAccessLogLogfmt(t *testing.T) {
+	var buf bytes.Buffer
+	writeLogfmt(&buf, []logField{
+		{"method", "GET"},
+		{"params", map[string]string{"b": "2", "a": "x y"}},
+		{"status", 200},
+		{"user_agent", `say "hi"`},
+		{"user", ""},
+	})
+
+	want := `method=GET params.a="x y" params.b=2 status=200 user_agent="say \"hi\"" user=""` + "\n"
+	if buf.String() != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, buf.String())
+	}
+}
+
+func TestAccessLogLogfmtMiddleware(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		h   = AccessLogConf{Writer: &buf, Logfmt: true}.Middleware().Handler("GET", "/items", http.NotFoundHandler())
+	)
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/items", nil))
+
+	line := buf.String()
+	for _, s := range []string{"method=GET ", "route=/items ", "status=404 ", "proto=HTTP/1.1 "} {
+		if !strings.Contains(line, s) {
+			t.Errorf("expected %q in %q", s, line)
+		}
+	}
+	if !strings.HasSuffix(line, "\n") || strings.Count(line, "\n") != 1 {
+		t.Errorf("expected a single line, got %q", line)
+	}
+}
@@ -3,6 +3,7 @@ package httpsrv
 import (
 	"encoding/json"
 	"html/template"
+	"io/fs"
 	"net/http"
 	"strings"
 
@@ -20,7 +21,8 @@ func fixPrefix(prefix string) string {
 	return prefix
 }
 
-// AssetsRoute returns a Route to handle static assets
+// AssetsRoute returns a Route to handle static assets with
+// AssetsHandler
 func AssetsRoute(prefix string, fs http.FileSystem, mws ...Middleware) *Route {
 	prefix = fixPrefix(prefix)
 
@@ -28,10 +30,16 @@ func AssetsRoute(prefix string, fs http.FileSystem, mws ...Middleware) *Route {
 		Method:     "GET",
 		Path:       prefix + "*splat",
 		Middleware: mws,
-		Handler:    http.StripPrefix(prefix, http.FileServer(fs)),
+		Handler:    http.StripPrefix(prefix, AssetsHandler(fs)),
 	}
 }
 
+// AssetsRouteFS returns a Route to handle static assets from fsys,
+// e.g. an embed.FS
+func AssetsRouteFS(prefix string, fsys fs.FS, mws ...Middleware) *Route {
+	return AssetsRoute(prefix, http.FS(fsys), mws...)
+}
+
 // TemplateHandler returns an http.Handler that renders the provided template
 func TemplateHandler(t *template.Template, fn func(*http.Request) interface{}) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -54,8 +62,11 @@ type SPAConf struct {
 	IndexMiddleware   []Middleware
 	Assets            http.FileSystem
 	AssetFile         string
-	AssetPrefix       string
-	AssetMiddleware   []Middleware
+	// AssetFormat is the format of AssetFile. Bundler manifests are
+	// exposed to IndexTemplate through ManifestFuncs.
+	AssetFormat     ManifestFormat
+	AssetPrefix     string
+	AssetMiddleware []Middleware
 }
 
 // Init initializes all the routes and confs for SPAConf
@@ -99,12 +110,34 @@ func (c SPAConf) mkIndexHandler(assets http.FileSystem) (http.Handler, error) {
 	if err != nil {
 		return nil, err
 	}
-	var js map[string]map[string]interface{}
-	if err := json.Unmarshal(b, &js); err != nil {
+
+	if c.AssetFormat == ManifestJSON {
+		var js map[string]map[string]interface{}
+		if err := json.Unmarshal(b, &js); err != nil {
+			return nil, err
+		}
+
+		return TemplateHandler(c.IndexTemplate, func(r *http.Request) interface{} {
+			return c.IndexTemplateData(r, js)
+		}), nil
+	}
+
+	m, err := ParseManifest(c.AssetFormat, b)
+	if err != nil {
+		return nil, err
+	}
+	m.Base = fixPrefix(c.AssetPrefix)
+
+	t, err := c.IndexTemplate.Clone()
+	if err != nil {
 		return nil, err
 	}
+	t.Funcs(ManifestFuncs(m))
 
-	return TemplateHandler(c.IndexTemplate, func(r *http.Request) interface{} {
-		return c.IndexTemplateData(r, js)
+	return TemplateHandler(t, func(r *http.Request) interface{} {
+		if c.IndexTemplateData == nil {
+			return m
+		}
+		return c.IndexTemplateData(r, nil)
 	}), nil
 }
@@ -1,8 +1,10 @@
+//go:build dev
 // +build dev
 
 package httpsrv
 
 import (
+	"io/fs"
 	"net/http"
 
 	"github.com/jonasi/ctxlog"
@@ -20,3 +22,9 @@ func (c SPAConf) indexHandler(assets http.FileSystem) (http.Handler, error) {
 		h.ServeHTTP(w, r)
 	}), nil
 }
+
+// AssetsFS returns the assets in dir on disk, ignoring embedded, so
+// changes are picked up without rebuilding
+func AssetsFS(embedded fs.FS, dir string) http.FileSystem {
+	return http.Dir(dir)
+}
@@ -1,11 +1,29 @@
+//go:build !dev
 // +build !dev
 
 package httpsrv
 
 import (
+	"io/fs"
 	"net/http"
 )
 
 func (c SPAConf) indexHandler(assets http.FileSystem) (http.Handler, error) {
 	return c.mkIndexHandler(assets)
 }
+
+// AssetsFS returns the assets in dir from embedded, e.g. for
+// SPAConf.Assets. Dev builds serve dir from disk instead.
+//
+//	//go:embed web/dist
+//	var dist embed.FS
+//
+//	conf.Assets = httpsrv.AssetsFS(dist, "web/dist")
+func AssetsFS(embedded fs.FS, dir string) http.FileSystem {
+	sub, err := fs.Sub(embedded, dir)
+	if err != nil {
+		panic("Invalid embedded assets dir: " + err.Error())
+	}
+
+	return http.FS(sub)
+}
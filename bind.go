@@ -0,0 +1,241 @@
+package httpsrv
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// bindSources maps the struct tags understood by Bind to the
+// functions used to pull values from the request
+var bindSources = []struct {
+	tag string
+	fn  func(*http.Request, string) ReqValues
+}{
+	{"path", ParamValues},
+	{"query", QueryValues},
+	{"header", HeaderValues},
+	{"cookie", CookieValues},
+	{"form", FormValues},
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	timeType            = reflect.TypeOf(time.Time{})
+	uuidType            = reflect.TypeOf(uuid.UUID{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Bind populates the struct pointed to by dst from r.
+//
+// JSON request bodies are decoded into dst first using
+// DefaultJSONDecoder. Afterwards, fields tagged with path, query,
+// header, cookie or form are set from the matching part of the
+// request, e.g.
+//
+//	type listReq struct {
+//		ID     uuid.UUID `path:"id"`
+//		Limit  int       `query:"limit" default:"20"`
+//		Tenant string    `header:"X-Tenant"`
+//	}
+//
+// Missing values fall back to the default tag. Once bound, dst is
+// checked against its validate tags as described in Validate. Every
+// field that fails to convert or validate is reported in the returned
+// ParamErrors.
+func Bind(r *http.Request, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("httpsrv: Bind expects a pointer to a struct, got %T", dst)
+	}
+
+	if err := bindBody(r, dst); err != nil {
+		return err
+	}
+
+	var (
+		errs    ParamErrors
+		present = map[string]bool{}
+	)
+	bindStruct(r, v.Elem(), present, &errs)
+
+	// fields that failed to bind have already been reported
+	skip := map[string]bool{}
+	for _, err := range errs {
+		skip[err.Source+":"+err.Key] = true
+	}
+
+	if err := validateStruct(v.Elem(), "", skip, present, &errs); err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func bindBody(r *http.Request, dst interface{}) error {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if ct != "application/json" {
+		return nil
+	}
+
+	return DefaultJSONDecoder.Decode(r, dst)
+}
+
+// bindStruct sets the tagged fields of v from r, recording the
+// source:key of every value found in present
+func bindStruct(r *http.Request, v reflect.Value, present map[string]bool, errs *ParamErrors) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		var (
+			f  = t.Field(i)
+			fv = v.Field(i)
+		)
+
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			bindStruct(r, fv, present, errs)
+			continue
+		}
+
+		for _, src := range bindSources {
+			key, ok := f.Tag.Lookup(src.tag)
+			if !ok || key == "-" {
+				continue
+			}
+
+			rv := src.fn(r, key)
+			if rv.readErr != nil {
+				*errs = append(*errs, rv.err(rv.readErr))
+				break
+			}
+
+			if !rv.Exists() {
+				def, ok := f.Tag.Lookup("default")
+				if !ok {
+					break
+				}
+				rv = NewReqValues(src.tag, key, def)
+			}
+			present[src.tag+":"+key] = true
+
+			if err := rv.bind(fv); err != nil {
+				var perr *ParamError
+				if errors.As(err, &perr) {
+					*errs = append(*errs, perr)
+				}
+			}
+			break
+		}
+	}
+}
+
+// bind sets v from r using the same conversions as the typed accessors
+func (r ReqValues) bind(v reflect.Value) error {
+	if v.Kind() == reflect.Ptr {
+		p := reflect.New(v.Type().Elem())
+		if err := r.bind(p.Elem()); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		strs := r.Strings()
+		sl := reflect.MakeSlice(v.Type(), len(strs), len(strs))
+		for i, s := range strs {
+			if err := setString(sl.Index(i), s); err != nil {
+				return &ParamError{Source: r.source, Key: r.key, Value: s, Err: err}
+			}
+		}
+		v.Set(sl)
+		return nil
+	}
+
+	return r.parse(func(s string) error {
+		return setString(v, s)
+	})
+}
+
+var errUnsupportedType = errors.New("unsupported type")
+
+func setString(v reflect.Value, s string) error {
+	switch v.Type() {
+	case durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	case timeType:
+		t, err := parseTime(s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case uuidType:
+		u, err := uuid.FromString(s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(u))
+		return nil
+	}
+
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	default:
+		return errUnsupportedType
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package httpsrv
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type listReq struct {
+	Limit int    `query:"limit" validate:"min=1,max=100"`
+	Sort  string `query:"sort" validate:"oneof=asc desc"`
+	Page  int    `query:"page" validate:"required"`
+	Size  int    `query:"size" default:"20" validate:"min=1"`
+}
+
+func bindQuery(t *testing.T, query string) (listReq, error) {
+	t.Helper()
+
+	var (
+		req listReq
+		r   = httptest.NewRequest("GET", "/items?"+query, nil)
+	)
+
+	return req, Bind(r, &req)
+}
+
+func TestBindAbsentOptionalFields(t *testing.T) {
+	req, err := bindQuery(t, "page=0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if req.Limit != 0 || req.Sort != "" || req.Page != 0 || req.Size != 20 {
+		t.Errorf("unexpected bind result %+v", req)
+	}
+}
+
+func TestBindPresentFields(t *testing.T) {
+	req, err := bindQuery(t, "limit=10&sort=desc&page=2&size=5")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if req.Limit != 10 || req.Sort != "desc" || req.Page != 2 || req.Size != 5 {
+		t.Errorf("unexpected bind result %+v", req)
+	}
+}
+
+func TestBindInvalidFields(t *testing.T) {
+	for _, tt := range []struct {
+		query string
+		err   string
+	}{
+		{"page=1&limit=0", `invalid query value "limit": must be at least 1`},
+		{"page=1&limit=101", `invalid query value "limit": must be at most 100`},
+		{"page=1&sort=up", `invalid query value "sort": must be one of [asc, desc]`},
+		{"page=1&size=0", `invalid query value "size": must be at least 1`},
+		{"page=x", `invalid query value "page"`},
+	} {
+		_, err := bindQuery(t, tt.query)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+			t.Errorf("%s: expected %q, got %v", tt.query, tt.err, err)
+		}
+	}
+}
+
+func TestBindMissingRequired(t *testing.T) {
+	_, err := bindQuery(t, "limit=5")
+
+	errs, ok := err.(ParamErrors)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("expected one ParamError, got %v", err)
+	}
+	if errs[0].Key != "page" || errs[0].Err != ErrMissingValue {
+		t.Errorf("unexpected error %s", errs[0])
+	}
+}
+
+func TestReqValuesRulesAbsent(t *testing.T) {
+	r := httptest.NewRequest("GET", "/items", nil)
+
+	if _, err := QueryValues(r, "limit").Rules("min=1").IntE(); err != nil {
+		t.Errorf("absent optional value failed: %s", err)
+	}
+	if _, err := QueryValues(r, "limit").Rules("required,min=1").IntE(); err == nil {
+		t.Error("absent required value passed")
+	}
+}
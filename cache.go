@@ -0,0 +1,244 @@
+package httpsrv
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+)
+
+// NewCachedFS returns an initialized *CachedFS that holds at most
+// maxBytes of file contents from fs in memory
+func NewCachedFS(fs http.FileSystem, maxBytes int64) *CachedFS {
+	return &CachedFS{
+		fs:       fs,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		misses:   list.New(),
+		entries:  map[string]*list.Element{},
+	}
+}
+
+// CachedFS is an http.FileSystem that caches file contents, metadata
+// and content hashes from another http.FileSystem in memory, evicting
+// the least recently used files once the size bound is reached.
+// Directories and files larger than the bound are not cached. Files that
+// do not exist are remembered too, so probing for optional files, e.g.
+// precompressed siblings, does not hit fs. In dev builds cached files
+// are reloaded when they change on disk.
+type CachedFS struct {
+	fs       http.FileSystem
+	maxBytes int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List
+	misses  *list.List
+	entries map[string]*list.Element
+}
+
+// maxCachedMisses bounds the number of missing files remembered
+const maxCachedMisses = 1024
+
+type cacheEntry struct {
+	name string
+	data []byte
+	info os.FileInfo
+	hash [sha256.Size]byte
+	// err is set for files that do not exist
+	err error
+}
+
+// Open satisfies http.FileSystem
+func (c *CachedFS) Open(name string) (http.File, error) {
+	name = path.Clean("/" + name)
+
+	c.mu.Lock()
+	el, ok := c.entries[name]
+	if ok {
+		if el.Value.(*cacheEntry).err != nil {
+			c.misses.MoveToFront(el)
+		} else {
+			c.lru.MoveToFront(el)
+		}
+	}
+	c.mu.Unlock()
+
+	if ok {
+		e := el.Value.(*cacheEntry)
+		if !c.stale(e) {
+			if e.err != nil {
+				return nil, e.err
+			}
+			return newCachedFile(e), nil
+		}
+		c.Invalidate(name)
+	}
+
+	return c.load(name)
+}
+
+func (c *CachedFS) load(name string) (http.File, error) {
+	f, err := c.fs.Open(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			c.add(&cacheEntry{name: name, err: err})
+		}
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if fi.IsDir() || fi.Size() > c.maxBytes {
+		return f, nil
+	}
+
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &cacheEntry{name: name, data: data, info: fi, hash: sha256.Sum256(data)}
+	c.add(e)
+
+	return newCachedFile(e), nil
+}
+
+func (c *CachedFS) add(e *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[e.name]; ok {
+		c.remove(el)
+	}
+
+	if e.err != nil {
+		c.entries[e.name] = c.misses.PushFront(e)
+		for c.misses.Len() > maxCachedMisses {
+			c.remove(c.misses.Back())
+		}
+		return
+	}
+
+	c.entries[e.name] = c.lru.PushFront(e)
+	c.size += int64(len(e.data))
+
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove drops el from the cache. c.mu must be held.
+func (c *CachedFS) remove(el *list.Element) {
+	e := el.Value.(*cacheEntry)
+	if e.err != nil {
+		c.misses.Remove(el)
+	} else {
+		c.lru.Remove(el)
+		c.size -= int64(len(e.data))
+	}
+	delete(c.entries, e.name)
+}
+
+// Invalidate drops the named files from the cache, or every file if no
+// names are provided
+func (c *CachedFS) Invalidate(names ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(names) == 0 {
+		c.lru.Init()
+		c.misses.Init()
+		c.entries = map[string]*list.Element{}
+		c.size = 0
+		return
+	}
+
+	for _, name := range names {
+		if el, ok := c.entries[path.Clean("/"+name)]; ok {
+			c.remove(el)
+		}
+	}
+}
+
+// Size returns the number of bytes of file contents cached
+func (c *CachedFS) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// Preload caches every file under the directory root, e.g. when the
+// server starts, until the cache is full
+func (c *CachedFS) Preload(root string) error {
+	root = path.Clean("/" + root)
+
+	f, err := c.fs.Open(root)
+	if err != nil {
+		return err
+	}
+
+	fis, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range fis {
+		name := path.Join(root, fi.Name())
+		if fi.IsDir() {
+			if err := c.Preload(name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if c.Size()+fi.Size() > c.maxBytes {
+			continue
+		}
+
+		f, err := c.load(name)
+		if err != nil {
+			return err
+		}
+		f.Close()
+	}
+
+	return nil
+}
+
+// cachedFile is an http.File reading from a cache entry
+type cachedFile struct {
+	*bytes.Reader
+	entry *cacheEntry
+}
+
+func newCachedFile(e *cacheEntry) *cachedFile {
+	return &cachedFile{Reader: bytes.NewReader(e.data), entry: e}
+}
+
+var errNotDir = errors.New("not a directory")
+
+func (f *cachedFile) Close() error                       { return nil }
+func (f *cachedFile) Readdir(int) ([]os.FileInfo, error) { return nil, errNotDir }
+func (f *cachedFile) Stat() (os.FileInfo, error)         { return f.entry.info, nil }
+
+// Hash returns the sha256 of the file contents
+func (f *cachedFile) Hash() [sha256.Size]byte { return f.entry.hash }
+
+// ETag returns a strong ETag of the file contents
+func (f *cachedFile) ETag() string {
+	return hashETag(f.entry.hash[:])
+}
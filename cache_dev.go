@@ -0,0 +1,25 @@
+//go:build dev
+// +build dev
+
+package httpsrv
+
+// stale reports whether the file behind e has changed, been removed or
+// been created since it was cached
+func (c *CachedFS) stale(e *cacheEntry) bool {
+	f, err := c.fs.Open(e.name)
+	if err != nil {
+		return e.err == nil
+	}
+	defer f.Close()
+
+	if e.err != nil {
+		return true
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return true
+	}
+
+	return !fi.ModTime().Equal(e.info.ModTime()) || fi.Size() != e.info.Size()
+}
@@ -0,0 +1,39 @@
+//go:build dev
+// +build dev
+
+package httpsrv
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestCachedFSDevInvalidation(t *testing.T) {
+	var (
+		mfs   = fstest.MapFS{"a.txt": {Data: []byte("one"), ModTime: time.Unix(1, 0)}}
+		under = newCountingFS(mfs)
+		c     = NewCachedFS(under, 1024)
+	)
+
+	if b, _ := ReadFile(c, "/a.txt"); string(b) != "one" {
+		t.Fatalf("unexpected contents %q", b)
+	}
+
+	mfs["a.txt"] = &fstest.MapFile{Data: []byte("two!"), ModTime: time.Unix(2, 0)}
+	if b, _ := ReadFile(c, "/a.txt"); string(b) != "two!" {
+		t.Errorf("changed file not reloaded, got %q", b)
+	}
+
+	delete(mfs, "a.txt")
+	if _, err := c.Open("/a.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("removed file still served, got %v", err)
+	}
+
+	mfs["a.txt"] = &fstest.MapFile{Data: []byte("three")}
+	if b, _ := ReadFile(c, "/a.txt"); string(b) != "three" {
+		t.Errorf("created file not served, got %q", b)
+	}
+}
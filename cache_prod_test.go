@@ -0,0 +1,119 @@
+//go:build !dev
+// +build !dev
+
+package httpsrv
+
+import (
+	"errors"
+	"io/fs"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCachedFSHit(t *testing.T) {
+	var (
+		under = newCountingFS(fstest.MapFS{"a.txt": {Data: []byte("hello")}})
+		c     = NewCachedFS(under, 1024)
+	)
+
+	for i := 0; i < 3; i++ {
+		b, err := ReadFile(c, "/a.txt")
+		if err != nil || string(b) != "hello" {
+			t.Fatalf("unexpected read %q, %v", b, err)
+		}
+	}
+
+	if n := under.count("/a.txt"); n != 1 {
+		t.Errorf("expected 1 open, got %d", n)
+	}
+	if n := c.Size(); n != 5 {
+		t.Errorf("expected size 5, got %d", n)
+	}
+}
+
+func TestCachedFSMiss(t *testing.T) {
+	var (
+		under = newCountingFS(fstest.MapFS{"a.txt": {Data: []byte("hello")}})
+		c     = NewCachedFS(under, 1024)
+	)
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.Open("/missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("expected ErrNotExist, got %v", err)
+		}
+	}
+
+	if n := under.count("/missing.txt"); n != 1 {
+		t.Errorf("expected 1 open, got %d", n)
+	}
+
+	c.Invalidate("/missing.txt")
+	_, _ = c.Open("/missing.txt")
+	if n := under.count("/missing.txt"); n != 2 {
+		t.Errorf("expected Invalidate to drop the miss, got %d opens", n)
+	}
+}
+
+func TestCachedFSAssets(t *testing.T) {
+	var (
+		under = newCountingFS(fstest.MapFS{"app.js": {Data: []byte("console.log(1)")}})
+		h     = AssetsHandler(NewCachedFS(under, 1024))
+	)
+
+	for i := 0; i < 3; i++ {
+		r := httptest.NewRequest("GET", "/app.js", nil)
+		r.Header.Set("Accept-Encoding", "br, gzip")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	for _, name := range []string{"/app.js", "/app.js.br", "/app.js.gz", "/app.js.zst"} {
+		if n := under.count(name); n != 1 {
+			t.Errorf("expected 1 open of %s, got %d", name, n)
+		}
+	}
+}
+
+func TestCachedFSEviction(t *testing.T) {
+	var (
+		under = newCountingFS(fstest.MapFS{
+			"a": {Data: []byte("aaaa")},
+			"b": {Data: []byte("bbbb")},
+			"c": {Data: []byte("cccc")},
+			"d": {Data: []byte("dddddddddddd")},
+		})
+		c = NewCachedFS(under, 10)
+	)
+
+	for _, name := range []string{"/a", "/b", "/a", "/c"} {
+		if _, err := ReadFile(c, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// b was least recently used when c was added
+	for _, name := range []string{"/a", "/c", "/b"} {
+		if _, err := ReadFile(c, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, want := range map[string]int{"/a": 1, "/b": 2, "/c": 1} {
+		if n := under.count(name); n != want {
+			t.Errorf("expected %d opens of %s, got %d", want, name, n)
+		}
+	}
+	if n := c.Size(); n > 10 {
+		t.Errorf("size %d exceeds the bound", n)
+	}
+
+	// files larger than the bound are served but not cached
+	for i := 0; i < 2; i++ {
+		if b, err := ReadFile(c, "/d"); err != nil || len(b) != 12 {
+			t.Fatalf("unexpected read %q, %v", b, err)
+		}
+	}
+	if n := under.count("/d"); n != 2 {
+		t.Errorf("expected 2 opens of /d, got %d", n)
+	}
+}
@@ -0,0 +1,57 @@
+package httpsrv
+
+import (
+	"io/fs"
+	"net/http"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// countingFS counts the opens of each name
+type countingFS struct {
+	http.FileSystem
+
+	mu    sync.Mutex
+	opens map[string]int
+}
+
+func newCountingFS(fsys fs.FS) *countingFS {
+	return &countingFS{FileSystem: http.FS(fsys), opens: map[string]int{}}
+}
+
+func (c *countingFS) Open(name string) (http.File, error) {
+	c.mu.Lock()
+	c.opens[name]++
+	c.mu.Unlock()
+	return c.FileSystem.Open(name)
+}
+
+func (c *countingFS) count(name string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.opens[name]
+}
+
+func TestCachedFSETag(t *testing.T) {
+	c := NewCachedFS(http.FS(fstest.MapFS{"a.txt": {Data: []byte("hello")}}), 1024)
+
+	f, err := c.Open("/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	e, ok := f.(etagger)
+	if !ok {
+		t.Fatal("cached files should provide an ETag")
+	}
+
+	want, _ := fileETag(readSeekerFile{f})
+	if e.ETag() != want {
+		t.Errorf("expected %s, got %s", want, e.ETag())
+	}
+}
+
+// readSeekerFile hides the ETag method of a file
+type readSeekerFile struct{ http.File }
@@ -0,0 +1,107 @@
+package httpsrv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+)
+
+// cbor major types, RFC 8949 section 3.1
+const (
+	cborUint   = 0 << 5
+	cborNegInt = 1 << 5
+	cborBytes  = 2 << 5
+	cborText   = 3 << 5
+	cborArray  = 4 << 5
+	cborMap    = 5 << 5
+	cborSimple = 7 << 5
+)
+
+func encodeCBOR(w io.Writer, v interface{}) error {
+	var buf cborWriter
+	if err := writeBinary(&buf, reflect.ValueOf(v)); err != nil {
+		return fmt.Errorf("cbor: %w", err)
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// cborWriter writes values in the cbor format, RFC 8949
+type cborWriter struct {
+	bytes.Buffer
+}
+
+func (c *cborWriter) writeNil() {
+	c.WriteByte(cborSimple | 22)
+}
+
+func (c *cborWriter) writeBool(b bool) {
+	if b {
+		c.WriteByte(cborSimple | 21)
+	} else {
+		c.WriteByte(cborSimple | 20)
+	}
+}
+
+func (c *cborWriter) writeInt(n int64) {
+	if n >= 0 {
+		c.writeHead(cborUint, uint64(n))
+	} else {
+		c.writeHead(cborNegInt, uint64(-1-n))
+	}
+}
+
+func (c *cborWriter) writeUint(n uint64) {
+	c.writeHead(cborUint, n)
+}
+
+func (c *cborWriter) writeFloat(f float64, bits int) {
+	if bits == 32 {
+		c.WriteByte(cborSimple | 26)
+		_ = binary.Write(c, binary.BigEndian, math.Float32bits(float32(f)))
+		return
+	}
+
+	c.WriteByte(cborSimple | 27)
+	_ = binary.Write(c, binary.BigEndian, math.Float64bits(f))
+}
+
+func (c *cborWriter) writeString(s string) {
+	c.writeHead(cborText, uint64(len(s)))
+	c.WriteString(s)
+}
+
+func (c *cborWriter) writeBytes(b []byte) {
+	c.writeHead(cborBytes, uint64(len(b)))
+	c.Write(b)
+}
+
+func (c *cborWriter) writeArrayHead(n int) {
+	c.writeHead(cborArray, uint64(n))
+}
+
+func (c *cborWriter) writeMapHead(n int) {
+	c.writeHead(cborMap, uint64(n))
+}
+
+func (c *cborWriter) writeHead(major byte, n uint64) {
+	switch {
+	case n < 24:
+		c.WriteByte(major | byte(n))
+	case n <= math.MaxUint8:
+		c.Write([]byte{major | 24, byte(n)})
+	case n <= math.MaxUint16:
+		c.WriteByte(major | 25)
+		_ = binary.Write(c, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		c.WriteByte(major | 26)
+		_ = binary.Write(c, binary.BigEndian, uint32(n))
+	default:
+		c.WriteByte(major | 27)
+		_ = binary.Write(c, binary.BigEndian, n)
+	}
+}
@@ -0,0 +1,42 @@
+package httpsrv
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCBOREncoder(t *testing.T) {
+	expectEncoding(t, CBOREncoder, testBinaryValue, ""+
+		"ac"+ // map of 12
+		"626964"+"6178"+ // id: "x"
+		"646e616d65"+"616e"+ // name: "n"
+		"63626967"+"1b0020000000000001"+ // big: 2^53+1
+		"636d6178"+"1bffffffffffffffff"+ // max: 2^64-1
+		"636e6567"+"38c7"+ // neg: -200
+		"65726174696f"+"fa3f000000"+ // ratio: float32 0.5
+		"6573636f7265"+"fb3ff8000000000000"+ // score: 1.5
+		"63726177"+"420102"+ // raw: bytes 0102
+		"626f6b"+"f5"+ // ok: true
+		"636e696c"+"f6"+ // nil: null
+		"626174"+"74323032342d30312d30325430333a30343a30355a"+ // at: "2024-01-02T03:04:05Z"
+		"6454616773"+"a2"+"6161"+"01"+"6162"+"02", // Tags: {a: 1, b: 2}
+	)
+}
+
+func TestCBOREncoderScalars(t *testing.T) {
+	for _, tt := range []struct {
+		v    interface{}
+		want string
+	}{
+		{nil, "f6"},
+		{false, "f4"},
+		{[]int{}, "80"},
+		{-1, "20"},
+		{24, "1818"},
+		{1000, "1903e8"},
+		{int64(math.MinInt64), "3b7fffffffffffffff"},
+		{[]string{"a"}, "816161"},
+	} {
+		expectEncoding(t, CBOREncoder, tt.v, tt.want)
+	}
+}
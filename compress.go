@@ -0,0 +1,379 @@
+package httpsrv
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// DefaultCompressTypes are the content types compressed by default.
+// Entries ending in /* match any subtype.
+var DefaultCompressTypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/wasm",
+	"application/x-ndjson",
+	"application/problem+json",
+	"application/manifest+json",
+	"image/svg+xml",
+}
+
+// CompressConf configures response compression
+type CompressConf struct {
+	// Encodings are the supported encodings in order of preference,
+	// used to break ties between equally weighted encodings accepted
+	// by the client. Defaults to br, zstd, gzip.
+	Encodings []string
+	// ContentTypes are the content types to compress. Defaults to
+	// DefaultCompressTypes.
+	ContentTypes []string
+	// MinSize is the smallest response compressed, in bytes. Defaults
+	// to 1024. Flushed responses are compressed regardless of size.
+	MinSize int
+}
+
+// Middleware returns a Middleware that compresses responses using the
+// best encoding accepted by the client. Responses that already have a
+// Content-Encoding, e.g. precompressed assets, partial content and
+// protocol upgrades such as h2c are passed through untouched.
+func (c CompressConf) Middleware() Middleware {
+	if len(c.Encodings) == 0 {
+		c.Encodings = []string{"br", "zstd", "gzip"}
+	}
+
+	encs := []string{}
+	for _, enc := range c.Encodings {
+		if _, ok := compressors[enc]; ok {
+			encs = append(encs, enc)
+		}
+	}
+	c.Encodings = encs
+
+	if c.ContentTypes == nil {
+		c.ContentTypes = DefaultCompressTypes
+	}
+	if c.MinSize <= 0 {
+		c.MinSize = 1024
+	}
+
+	return MiddlewareFunc("compress", func(method, path string, h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Upgrade") != "" || r.Method == "PRI" {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			enc := negotiateEncoding(r.Header.Get("Accept-Encoding"), c.Encodings)
+			if enc == "" || r.Method == http.MethodHead {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, conf: &c, enc: enc}
+			defer cw.close()
+
+			h.ServeHTTP(cw, r)
+		})
+	})
+}
+
+// negotiateEncoding returns the supported encoding with the highest
+// q-value in the Accept-Encoding header h, or "" if none are accepted
+func negotiateEncoding(h string, supported []string) string {
+	if h == "" {
+		return ""
+	}
+
+	var (
+		qs       = map[string]float64{}
+		wildcard = -1.0
+	)
+
+	for _, part := range strings.Split(h, ",") {
+		params := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, p := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+			if len(kv) == 2 && strings.EqualFold(kv[0], "q") {
+				if f, err := strconv.ParseFloat(kv[1], 64); err == nil {
+					q = f
+				}
+			}
+		}
+
+		if name == "*" {
+			wildcard = q
+		} else {
+			qs[name] = q
+		}
+	}
+
+	var (
+		best  string
+		bestQ float64
+	)
+
+	for _, enc := range supported {
+		q, ok := qs[enc]
+		if !ok && enc == "gzip" {
+			q, ok = qs["x-gzip"]
+		}
+		if !ok {
+			q = wildcard
+		}
+
+		if q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+
+	return best
+}
+
+// compressor is a pooled encoder
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+var compressors = map[string]*sync.Pool{
+	"gzip": {New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	}},
+	"br": {New: func() interface{} {
+		return brotli.NewWriterLevel(io.Discard, 5)
+	}},
+	"zstd": {New: func() interface{} {
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return w
+	}},
+}
+
+// compressWriter buffers the start of a response until it can decide
+// whether the response should be compressed
+type compressWriter struct {
+	http.ResponseWriter
+	conf *CompressConf
+	enc  string
+
+	status   int
+	buf      []byte
+	decided  bool
+	w        compressor
+	hijacked bool
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if status < 200 {
+		// pass informational responses, e.g. 103 Early Hints, through
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	if cw.status == 0 {
+		cw.status = status
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) < cw.conf.MinSize {
+			return len(b), nil
+		}
+
+		if err := cw.start(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	if cw.w != nil {
+		return cw.w.Write(b)
+	}
+
+	return cw.ResponseWriter.Write(b)
+}
+
+// start decides whether to compress and writes the buffered data
+func (cw *compressWriter) start(large bool) error {
+	cw.decided = true
+
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	if cw.shouldCompress(large) {
+		h := cw.Header()
+		h.Set("Content-Encoding", cw.enc)
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+
+		// the compressed bytes differ, but the representation is
+		// semantically the same
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+
+		cw.w = compressors[cw.enc].Get().(compressor)
+		cw.w.Reset(cw.ResponseWriter)
+	} else if !large && len(cw.buf) > 0 && cw.Header().Get("Content-Length") == "" {
+		cw.Header().Set("Content-Length", strconv.Itoa(len(cw.buf)))
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if len(cw.buf) == 0 {
+		return nil
+	}
+
+	buf := cw.buf
+	cw.buf = nil
+
+	if cw.w != nil {
+		_, err := cw.w.Write(buf)
+		return err
+	}
+
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+func (cw *compressWriter) shouldCompress(large bool) bool {
+	if !large {
+		return false
+	}
+
+	switch cw.status {
+	case http.StatusNoContent, http.StatusNotModified, http.StatusPartialContent:
+		return false
+	}
+
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" || strings.Contains(h.Get("Cache-Control"), "no-transform") {
+		return false
+	}
+
+	ct := h.Get("Content-Type")
+	if ct == "" {
+		ct = http.DetectContentType(cw.buf)
+		h.Set("Content-Type", ct)
+	}
+
+	typ, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+
+	for _, allowed := range cw.conf.ContentTypes {
+		if typ == allowed || (strings.HasSuffix(allowed, "/*") && strings.HasPrefix(typ, allowed[:len(allowed)-1])) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (cw *compressWriter) Flush() {
+	if cw.hijacked {
+		return
+	}
+
+	if !cw.decided {
+		// streamed responses are compressed regardless of size
+		if err := cw.start(true); err != nil {
+			return
+		}
+	}
+
+	if cw.w != nil {
+		if err := cw.w.Flush(); err != nil {
+			return
+		}
+	}
+
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errHijackNotSupported
+	}
+
+	cw.hijacked = true
+	return h.Hijack()
+}
+
+func (cw *compressWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := cw.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+
+	return http.ErrNotSupported
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressWriter) close() {
+	// a panicking handler's partial response is discarded rather than
+	// committed, leaving the error response to Recover or net/http
+	if v := recover(); v != nil {
+		cw.buf = nil
+		cw.release()
+		panic(v)
+	}
+
+	if cw.hijacked {
+		return
+	}
+
+	if !cw.decided && cw.status != 0 {
+		_ = cw.start(false)
+	}
+
+	if cw.w != nil {
+		_ = cw.w.Close()
+		cw.release()
+	}
+}
+
+// release returns the encoder to its pool without writing to the
+// response
+func (cw *compressWriter) release() {
+	if cw.w == nil {
+		return
+	}
+
+	cw.w.Reset(io.Discard)
+	compressors[cw.enc].Put(cw.w)
+	cw.w = nil
+}
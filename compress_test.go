@@ -0,0 +1,215 @@
+package httpsrv
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// serveCompressed serves a GET request with the Accept-Encoding header
+// ae through the compress middleware and h
+func serveCompressed(c CompressConf, ae string, h http.HandlerFunc) *httptest.ResponseRecorder {
+	var (
+		r = httptest.NewRequest("GET", "/", nil)
+		w = httptest.NewRecorder()
+	)
+
+	if ae != "" {
+		r.Header.Set("Accept-Encoding", ae)
+	}
+
+	c.Middleware().Handler("GET", "/", h).ServeHTTP(w, r)
+	return w
+}
+
+func writeText(n int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = io.WriteString(w, strings.Repeat("a", n))
+	}
+}
+
+func decompress(t *testing.T, enc string, b []byte) string {
+	t.Helper()
+
+	var (
+		r   io.Reader
+		err error
+	)
+
+	switch enc {
+	case "gzip":
+		r, err = gzip.NewReader(bytes.NewReader(b))
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(b))
+	case "zstd":
+		var d *zstd.Decoder
+		d, err = zstd.NewReader(bytes.NewReader(b))
+		if err == nil {
+			defer d.Close()
+		}
+		r = d
+	case "":
+		return string(b)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("%s: %s", enc, err)
+	}
+	return string(out)
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	supported := []string{"br", "zstd", "gzip"}
+
+	for h, want := range map[string]string{
+		"":                          "",
+		"gzip":                      "gzip",
+		"x-gzip":                    "gzip",
+		"GZIP;Q=1":                  "gzip",
+		"gzip, br":                  "br",
+		"gzip;q=0.5, br;q=0.8":      "br",
+		"gzip;q=1.0, br;q=0.9":      "gzip",
+		"br;q=0, *":                 "zstd",
+		"br;q=0, zstd;q=0, *;q=0.1": "gzip",
+		"*;q=0":                     "",
+		"identity":                  "",
+		"deflate, compress":         "",
+	} {
+		if got := negotiateEncoding(h, supported); got != want {
+			t.Errorf("%q: expected %q, got %q", h, want, got)
+		}
+	}
+}
+
+func TestCompressEncodings(t *testing.T) {
+	for _, enc := range []string{"br", "zstd", "gzip"} {
+		w := serveCompressed(CompressConf{}, enc, writeText(2048))
+
+		if got := w.Header().Get("Content-Encoding"); got != enc {
+			t.Errorf("expected %s, got %q", enc, got)
+		}
+		if body := decompress(t, enc, w.Body.Bytes()); body != strings.Repeat("a", 2048) {
+			t.Errorf("%s: unexpected body of %d bytes", enc, len(body))
+		}
+	}
+}
+
+func TestCompressMinSize(t *testing.T) {
+	for _, tt := range []struct {
+		conf CompressConf
+		size int
+		enc  string
+	}{
+		{CompressConf{}, 1023, ""},
+		{CompressConf{}, 1024, "gzip"},
+		{CompressConf{MinSize: 10}, 9, ""},
+		{CompressConf{MinSize: 10}, 10, "gzip"},
+	} {
+		w := serveCompressed(tt.conf, "gzip", writeText(tt.size))
+
+		if got := w.Header().Get("Content-Encoding"); got != tt.enc {
+			t.Errorf("%d bytes: expected encoding %q, got %q", tt.size, tt.enc, got)
+		}
+		if body := decompress(t, tt.enc, w.Body.Bytes()); len(body) != tt.size {
+			t.Errorf("%d bytes: unexpected body of %d bytes", tt.size, len(body))
+		}
+
+		cl := w.Header().Get("Content-Length")
+		if tt.enc == "" && cl == "" {
+			t.Errorf("%d bytes: expected a Content-Length", tt.size)
+		}
+		if tt.enc != "" && cl != "" {
+			t.Errorf("%d bytes: unexpected Content-Length %s", tt.size, cl)
+		}
+	}
+}
+
+func TestCompressContentEncoded(t *testing.T) {
+	body := strings.Repeat("z", 2048)
+
+	w := serveCompressed(CompressConf{}, "gzip, br", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Encoding", "zstd")
+		_, _ = io.WriteString(w, body)
+	})
+
+	if got := w.Header().Get("Content-Encoding"); got != "zstd" {
+		t.Errorf("expected Content-Encoding to be kept, got %q", got)
+	}
+	if w.Body.String() != body {
+		t.Error("encoded response was modified")
+	}
+}
+
+func TestCompressETag(t *testing.T) {
+	for _, tt := range []struct {
+		etag string
+		size int
+		want string
+	}{
+		{`"abc"`, 2048, `W/"abc"`},
+		{`W/"abc"`, 2048, `W/"abc"`},
+		{`"abc"`, 10, `"abc"`},
+	} {
+		w := serveCompressed(CompressConf{}, "gzip", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", tt.etag)
+			writeText(tt.size)(w, r)
+		})
+
+		if got := w.Header().Get("ETag"); got != tt.want {
+			t.Errorf("%s with %d bytes: expected %s, got %s", tt.etag, tt.size, tt.want, got)
+		}
+	}
+}
+
+func TestCompressVary(t *testing.T) {
+	for _, ae := range []string{"", "gzip"} {
+		w := serveCompressed(CompressConf{}, ae, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Origin")
+			writeText(2048)(w, r)
+		})
+
+		vary := w.Header().Values("Vary")
+		if len(vary) != 2 || vary[0] != "Accept-Encoding" || vary[1] != "Origin" {
+			t.Errorf("%q: unexpected Vary %v", ae, vary)
+		}
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	var flushed, compressed bool
+
+	w := serveCompressed(CompressConf{}, "gzip", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "data: 1\n\n")
+		w.(http.Flusher).Flush()
+
+		rec := w.(*compressWriter).ResponseWriter.(*httptest.ResponseRecorder)
+		flushed = rec.Flushed
+		compressed = rec.Header().Get("Content-Encoding") == "gzip"
+
+		_, _ = io.WriteString(w, "data: 2\n\n")
+	})
+
+	if !flushed {
+		t.Error("Flush was not passed through")
+	}
+	if !compressed {
+		t.Error("flushed response below MinSize was not compressed")
+	}
+	if body := decompress(t, "gzip", w.Body.Bytes()); body != "data: 1\n\ndata: 2\n\n" {
+		t.Errorf("unexpected body %q", body)
+	}
+}
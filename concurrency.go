@@ -0,0 +1,220 @@
+package httpsrv
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrOverloaded is written with a 503 when a request is shed
+var ErrOverloaded = errors.New("server overloaded")
+
+// ConcurrencyConf configures the concurrency limit middleware
+type ConcurrencyConf struct {
+	// Limit is the maximum number of requests served at once. In
+	// adaptive mode it is the initial limit.
+	Limit int
+	// QueueSize is the number of requests that may wait for a slot once
+	// the limit is reached
+	QueueSize int
+	// QueueTimeout bounds how long a request waits in the queue. Zero
+	// waits until the request is canceled.
+	QueueTimeout time.Duration
+	// PerRoute gives each route its own limit instead of sharing one
+	// across every route the middleware is applied to
+	PerRoute bool
+
+	// Adaptive adjusts the limit between MinLimit and MaxLimit with
+	// additive increase, multiplicative decrease: the limit grows while
+	// requests finish within TargetLatency and shrinks when they do not
+	// or fail with a server error. MinLimit defaults to 1 and MaxLimit
+	// to Limit.
+	Adaptive      bool
+	MinLimit      int
+	MaxLimit      int
+	TargetLatency time.Duration
+	// DecreaseWindow is the minimum time between decreases, so a burst
+	// of slow requests started under the same limit shrinks it once.
+	// Defaults to TargetLatency, or 1s if that is unset.
+	DecreaseWindow time.Duration
+}
+
+// Middleware returns a Middleware that bounds the number of in flight
+// requests and writes a 503 with WriteError for requests that cannot be
+// queued or wait too long. Routes with PriorityCritical are never
+// limited and PriorityLow routes are shed rather than queued. A
+// concurrency limit registered on a route replaces any registered
+// globally. It panics if the conf is invalid.
+func (c ConcurrencyConf) Middleware() Middleware {
+	if err := c.validate(); err != nil {
+		panic(err)
+	}
+
+	var shared *concurrencyLimiter
+	if !c.PerRoute {
+		shared = newConcurrencyLimiter(c)
+	}
+
+	return replacingMiddleware("concurrency_limit", func(method, path string, h http.Handler) http.Handler {
+		l := shared
+		if l == nil {
+			l = newConcurrencyLimiter(c)
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			prio := PriorityNormal
+			if rt := RouteFromContext(r.Context()); rt != nil {
+				prio = rt.Priority
+			}
+
+			if prio == PriorityCritical {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			if !l.acquire(r, prio) {
+				w.Header().Set("Retry-After", "1")
+				WriteError(w, r, NewStatusError(http.StatusServiceUnavailable, ErrOverloaded))
+				return
+			}
+
+			var (
+				start = time.Now()
+				rw    = wrapResponseWriter(w)
+			)
+
+			defer func() {
+				l.release(time.Since(start), rw.Status() < 500)
+			}()
+
+			h.ServeHTTP(rw, r)
+		})
+	})
+}
+
+// validate reports limits that are missing, negative or out of order
+func (c ConcurrencyConf) validate() error {
+	switch {
+	case c.Limit <= 0:
+		return fmt.Errorf("concurrency: Limit must be positive, got %d", c.Limit)
+	case c.QueueSize < 0:
+		return fmt.Errorf("concurrency: QueueSize must not be negative, got %d", c.QueueSize)
+	case !c.Adaptive:
+		return nil
+	case c.MinLimit < 0 || c.MaxLimit < 0:
+		return fmt.Errorf("concurrency: MinLimit and MaxLimit must not be negative, got %d and %d", c.MinLimit, c.MaxLimit)
+	case c.MaxLimit > 0 && c.MinLimit > c.MaxLimit:
+		return fmt.Errorf("concurrency: MinLimit %d is greater than MaxLimit %d", c.MinLimit, c.MaxLimit)
+	case c.Limit < c.MinLimit || (c.MaxLimit > 0 && c.Limit > c.MaxLimit):
+		return fmt.Errorf("concurrency: Limit %d is outside MinLimit %d and MaxLimit %d", c.Limit, c.MinLimit, c.MaxLimit)
+	}
+
+	return nil
+}
+
+// newConcurrencyLimiter returns a limiter for the validated conf c. An
+// unset MinLimit defaults to 1 and an unset MaxLimit to Limit.
+func newConcurrencyLimiter(c ConcurrencyConf) *concurrencyLimiter {
+	if c.MinLimit == 0 {
+		c.MinLimit = 1
+	}
+	if c.MaxLimit == 0 {
+		c.MaxLimit = c.Limit
+	}
+	if c.DecreaseWindow <= 0 {
+		c.DecreaseWindow = c.TargetLatency
+	}
+	if c.DecreaseWindow <= 0 {
+		c.DecreaseWindow = time.Second
+	}
+
+	return &concurrencyLimiter{conf: c, limit: float64(c.Limit), now: time.Now}
+}
+
+// concurrencyLimiter is a counting semaphore with a fifo wait queue
+type concurrencyLimiter struct {
+	conf ConcurrencyConf
+	now  func() time.Time
+
+	mu           sync.Mutex
+	limit        float64
+	lastDecrease time.Time
+	inFlight     int
+	waiters      []chan struct{}
+}
+
+func (l *concurrencyLimiter) acquire(r *http.Request, prio Priority) bool {
+	l.mu.Lock()
+	if l.inFlight < int(l.limit) {
+		l.inFlight++
+		l.mu.Unlock()
+		return true
+	}
+
+	if prio == PriorityLow || len(l.waiters) >= l.conf.QueueSize {
+		l.mu.Unlock()
+		return false
+	}
+
+	ch := make(chan struct{})
+	l.waiters = append(l.waiters, ch)
+	l.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if l.conf.QueueTimeout > 0 {
+		t := time.NewTimer(l.conf.QueueTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case <-ch:
+		return true
+	case <-timeout:
+	case <-r.Context().Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, w := range l.waiters {
+		if w == ch {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			return false
+		}
+	}
+
+	// a slot was handed over while giving up, so release it
+	l.inFlight--
+	l.dequeue()
+	return false
+}
+
+func (l *concurrencyLimiter) release(latency time.Duration, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conf.Adaptive {
+		if ok && (l.conf.TargetLatency <= 0 || latency <= l.conf.TargetLatency) {
+			l.limit = math.Min(float64(l.conf.MaxLimit), l.limit+1/l.limit)
+		} else if now := l.now(); now.Sub(l.lastDecrease) >= l.conf.DecreaseWindow {
+			l.limit = math.Max(float64(l.conf.MinLimit), l.limit*0.9)
+			l.lastDecrease = now
+		}
+	}
+
+	l.inFlight--
+	l.dequeue()
+}
+
+// dequeue hands free slots to waiting requests. l.mu must be held.
+func (l *concurrencyLimiter) dequeue() {
+	for l.inFlight < int(l.limit) && len(l.waiters) > 0 {
+		l.inFlight++
+		close(l.waiters[0])
+		l.waiters = l.waiters[1:]
+	}
+}
@@ -0,0 +1,212 @@
+package httpsrv
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyConfValidate(t *testing.T) {
+	for _, c := range []ConcurrencyConf{
+		{},
+		{Limit: -1},
+		{Limit: 1, QueueSize: -1},
+		{Limit: 5, Adaptive: true, MinLimit: 10, MaxLimit: 2},
+		{Limit: 5, Adaptive: true, MinLimit: 6},
+		{Limit: 5, Adaptive: true, MaxLimit: 4},
+		{Limit: 5, Adaptive: true, MinLimit: -1},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%+v: expected Middleware to panic", c)
+				}
+			}()
+			c.Middleware()
+		}()
+	}
+
+	for _, c := range []ConcurrencyConf{
+		{Limit: 1},
+		{Limit: 5, Adaptive: true},
+		{Limit: 5, Adaptive: true, MinLimit: 5, MaxLimit: 5},
+	} {
+		if err := c.validate(); err != nil {
+			t.Errorf("%+v: unexpected error %s", c, err)
+		}
+	}
+}
+
+// acquireAsync acquires a slot from l in the background and sends
+// whether it succeeded on the returned channel
+func acquireAsync(l *concurrencyLimiter, r *http.Request) <-chan bool {
+	ch := make(chan bool, 1)
+	go func() { ch <- l.acquire(r, PriorityNormal) }()
+	return ch
+}
+
+// waitQueued waits until n requests are queued on l
+func waitQueued(t *testing.T, l *concurrencyLimiter, n int) {
+	t.Helper()
+
+	for i := 0; i < 1000; i++ {
+		l.mu.Lock()
+		queued := len(l.waiters)
+		l.mu.Unlock()
+
+		if queued == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatalf("expected %d queued requests", n)
+}
+
+func TestConcurrencyLimiterQueue(t *testing.T) {
+	var (
+		l = newConcurrencyLimiter(ConcurrencyConf{Limit: 1, QueueSize: 1})
+		r = httptest.NewRequest("GET", "/", nil)
+	)
+
+	if !l.acquire(r, PriorityNormal) {
+		t.Fatal("first request not admitted")
+	}
+
+	queued := acquireAsync(l, r)
+	waitQueued(t, l, 1)
+
+	if l.acquire(r, PriorityNormal) {
+		t.Error("request admitted with a full queue")
+	}
+
+	l.release(0, true)
+	if !<-queued {
+		t.Error("queued request not admitted after a release")
+	}
+
+	l.release(0, true)
+	if l.inFlight != 0 {
+		t.Errorf("expected no requests in flight, got %d", l.inFlight)
+	}
+}
+
+func TestConcurrencyLimiterQueueCanceled(t *testing.T) {
+	var (
+		l           = newConcurrencyLimiter(ConcurrencyConf{Limit: 1, QueueSize: 2, QueueTimeout: 10 * time.Millisecond})
+		r           = httptest.NewRequest("GET", "/", nil)
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+
+	l.acquire(r, PriorityNormal)
+
+	timedOut := acquireAsync(l, r)
+	canceled := acquireAsync(l, r.WithContext(ctx))
+	waitQueued(t, l, 2)
+	cancel()
+
+	if <-timedOut || <-canceled {
+		t.Error("request admitted after giving up")
+	}
+	if len(l.waiters) != 0 {
+		t.Errorf("expected an empty queue, got %d", len(l.waiters))
+	}
+}
+
+func TestConcurrencyPriority(t *testing.T) {
+	var (
+		mw      = ConcurrencyConf{Limit: 1, QueueSize: 1}.Middleware()
+		block   = make(chan struct{})
+		started = make(chan struct{})
+		serve   = func(prio Priority, h http.HandlerFunc) int {
+			w := httptest.NewRecorder()
+			withRoute(&Route{Priority: prio}, mw.Handler("GET", "/", h)).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+			return w.Code
+		}
+	)
+
+	done := make(chan int)
+	go func() {
+		done <- serve(PriorityNormal, func(http.ResponseWriter, *http.Request) {
+			close(started)
+			<-block
+		})
+	}()
+	<-started
+
+	if code := serve(PriorityCritical, func(http.ResponseWriter, *http.Request) {}); code != http.StatusOK {
+		t.Errorf("critical request not bypassed: %d", code)
+	}
+	if code := serve(PriorityLow, func(http.ResponseWriter, *http.Request) {}); code != http.StatusServiceUnavailable {
+		t.Errorf("low priority request not shed: %d", code)
+	}
+
+	close(block)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("unexpected status %d", code)
+	}
+}
+
+func TestConcurrencyLimiterAdaptive(t *testing.T) {
+	var (
+		now = time.Unix(1700000000, 0)
+		l   = newConcurrencyLimiter(ConcurrencyConf{
+			Limit:          10,
+			Adaptive:       true,
+			MaxLimit:       11,
+			TargetLatency:  100 * time.Millisecond,
+			DecreaseWindow: time.Second,
+		})
+		r = httptest.NewRequest("GET", "/", nil)
+	)
+	l.now = func() time.Time { return now }
+
+	expectLimit := func(want float64) {
+		t.Helper()
+		if math.Abs(l.limit-want) > 1e-9 {
+			t.Errorf("expected limit %v, got %v", want, l.limit)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		l.acquire(r, PriorityNormal)
+	}
+
+	// a burst of slow requests decreases the limit once per window
+	for i := 0; i < 3; i++ {
+		l.release(200*time.Millisecond, true)
+	}
+	expectLimit(9)
+
+	now = now.Add(999 * time.Millisecond)
+	l.acquire(r, PriorityNormal)
+	l.release(0, false)
+	expectLimit(9)
+
+	now = now.Add(time.Millisecond)
+	l.acquire(r, PriorityNormal)
+	l.release(0, false)
+	expectLimit(8.1)
+
+	// fast requests increase it additively up to MaxLimit
+	l.acquire(r, PriorityNormal)
+	l.release(50*time.Millisecond, true)
+	expectLimit(8.1 + 1/8.1)
+
+	for i := 0; i < 100; i++ {
+		l.acquire(r, PriorityNormal)
+		l.release(0, true)
+	}
+	expectLimit(11)
+
+	// and never below MinLimit
+	for i := 0; i < 100; i++ {
+		now = now.Add(time.Second)
+		l.acquire(r, PriorityNormal)
+		l.release(time.Second, true)
+	}
+	expectLimit(1)
+}
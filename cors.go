@@ -0,0 +1,202 @@
+package httpsrv
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConf configures cross origin resource sharing
+type CORSConf struct {
+	// AllowedOrigins are exact origins, e.g. https://example.com,
+	// wildcard subdomains, e.g. https://*.example.com, or "*" for any
+	// origin
+	AllowedOrigins []string
+	// AllowedOriginPatterns are matched case insensitively against the
+	// full origin
+	AllowedOriginPatterns []*regexp.Regexp
+	// AllowedHeaders are the request headers allowed in preflights. If
+	// empty the requested headers are allowed.
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers scripts may read
+	ExposedHeaders []string
+	// AllowCredentials cannot be combined with the "*" origin
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache preflight responses
+	MaxAge time.Duration
+}
+
+// ErrCORSWildcardCredentials is returned by CORSConf.Init when any
+// origin is allowed along with credentials
+var ErrCORSWildcardCredentials = errors.New("cors: the \"*\" origin cannot be used with AllowCredentials")
+
+// Init registers the CORS middleware with s and answers preflight
+// requests for paths that have no OPTIONS route
+func (c CORSConf) Init(s *Server) error {
+	c, err := c.prepare()
+	if err != nil {
+		return err
+	}
+
+	s.AddMiddleware(c.middleware())
+	s.router.GlobalOPTIONS = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the router sets Allow to the methods registered for the path
+		c.preflight(w, r, strings.Split(w.Header().Get("Allow"), ", "))
+	})
+
+	return nil
+}
+
+// Middleware returns a Middleware that adds CORS headers to responses
+// for allowed origins and answers preflight requests with the methods
+// registered for the route in the server's route table. It panics if
+// the conf is invalid.
+func (c CORSConf) Middleware() Middleware {
+	c, err := c.prepare()
+	if err != nil {
+		panic(err)
+	}
+
+	return c.middleware()
+}
+
+// prepare validates c and returns a copy with its origin patterns
+// compiled case insensitively
+func (c CORSConf) prepare() (CORSConf, error) {
+	if c.AllowCredentials && containsString(c.AllowedOrigins, "*") {
+		return c, ErrCORSWildcardCredentials
+	}
+
+	patterns := make([]*regexp.Regexp, len(c.AllowedOriginPatterns))
+	for i, re := range c.AllowedOriginPatterns {
+		fold, err := regexp.Compile("(?i)" + re.String())
+		if err != nil {
+			return c, err
+		}
+		patterns[i] = fold
+	}
+	c.AllowedOriginPatterns = patterns
+
+	return c, nil
+}
+
+func (c CORSConf) middleware() Middleware {
+	return MiddlewareFunc("cors", func(method, path string, h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isPreflight(r) {
+				var methods []string
+				if s := ServerFromContext(r.Context()); s != nil && path != "" {
+					methods = s.methods(path)
+				}
+
+				c.preflight(w, r, methods)
+				return
+			}
+
+			w.Header().Add("Vary", "Origin")
+			if origin := r.Header.Get("Origin"); origin != "" && c.allowOrigin(origin) {
+				c.setOrigin(w, origin)
+				if len(c.ExposedHeaders) > 0 {
+					w.Header().Set("Access-Control-Expose-Headers", strings.Join(c.ExposedHeaders, ", "))
+				}
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	})
+}
+
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Origin") != "" && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+func (c CORSConf) preflight(w http.ResponseWriter, r *http.Request, methods []string) {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+
+	var (
+		origin = r.Header.Get("Origin")
+		method = r.Header.Get("Access-Control-Request-Method")
+	)
+
+	if !c.allowOrigin(origin) || !containsString(methods, method) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	c.setOrigin(w, origin)
+	h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+
+	if len(c.AllowedHeaders) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(c.AllowedHeaders, ", "))
+	} else if req := r.Header.Get("Access-Control-Request-Headers"); req != "" {
+		h.Set("Access-Control-Allow-Headers", req)
+	}
+
+	if c.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge.Seconds())))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c CORSConf) setOrigin(w http.ResponseWriter, origin string) {
+	// prepare rejects a wildcard with credentials
+	if containsString(c.AllowedOrigins, "*") {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if c.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c CORSConf) allowOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+
+	origin = strings.ToLower(origin)
+	for _, o := range c.AllowedOrigins {
+		o = strings.ToLower(o)
+		if o == "*" || o == origin {
+			return true
+		}
+
+		// https://*.example.com
+		if i := strings.Index(o, "://*."); i != -1 {
+			var (
+				scheme = o[:i+3]
+				suffix = o[i+4:]
+			)
+
+			if strings.HasPrefix(origin, scheme) && strings.HasSuffix(origin, suffix) && len(origin) > len(scheme)+len(suffix) {
+				return true
+			}
+		}
+	}
+
+	for _, re := range c.AllowedOriginPatterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsString(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package httpsrv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestCORSWildcardCredentials(t *testing.T) {
+	c := CORSConf{AllowedOrigins: []string{"*"}, AllowCredentials: true}
+
+	if err := c.Init(New(":0")); err != ErrCORSWildcardCredentials {
+		t.Errorf("expected ErrCORSWildcardCredentials, got %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected Middleware to panic")
+		}
+	}()
+	c.Middleware()
+}
+
+func TestCORSOriginPatterns(t *testing.T) {
+	c := CORSConf{AllowedOriginPatterns: []*regexp.Regexp{regexp.MustCompile(`^https://App\.example\.com$`)}}
+	h := c.Middleware().Handler("GET", "/", http.NotFoundHandler())
+
+	for origin, allowed := range map[string]bool{
+		"https://app.example.com":  true,
+		"https://APP.Example.com":  true,
+		"https://api.example.com":  false,
+		"https://app.example.com.": false,
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if got := w.Header().Get("Access-Control-Allow-Origin"); (got == origin) != allowed {
+			t.Errorf("%s: expected allowed=%v, got %q", origin, allowed, got)
+		}
+	}
+}
+
+func TestCORSCredentials(t *testing.T) {
+	c := CORSConf{AllowedOrigins: []string{"https://*.example.com"}, AllowCredentials: true}
+	h := c.Middleware().Handler("GET", "/", http.NotFoundHandler())
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("expected the origin to be echoed, got %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("expected credentials to be allowed, got %q", got)
+	}
+}
@@ -1,42 +1,269 @@
 package httpsrv
 
 import (
+	"bytes"
+	"html/template"
+	"io"
+	"io/fs"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 // NewDir returns an initialized *Dir
-func NewDir(dir http.Dir) *Dir {
+func NewDir(dir http.FileSystem) *Dir {
 	return &Dir{
 		dir:   dir,
 		files: map[string]func() (http.File, error){},
 	}
 }
 
-// Dir is an http.Filesystem that extends Dir and provides
-// the ability to server arbitrary files
+// NewDirFS returns an initialized *Dir on top of fsys, e.g. an embed.FS
+func NewDirFS(fsys fs.FS) *Dir {
+	return NewDir(http.FS(fsys))
+}
+
+// Dir is an http.Filesystem that extends another http.FileSystem
+// and provides the ability to server arbitrary files. Directories
+// containing added files appear in directory listings, even if they
+// do not exist in the underlying http.FileSystem.
 type Dir struct {
-	dir   http.Dir
+	dir   http.FileSystem
+	mu    sync.RWMutex
 	files map[string]func() (http.File, error)
 }
 
+// FileMeta is the metadata of a file added to a Dir. If ContentType is
+// empty it is derived from the file extension when served.
+type FileMeta struct {
+	ModTime     time.Time
+	ContentType string
+}
+
 // AddFile adds a file at name provided by fn()
 func (d *Dir) AddFile(name string, fn func() (http.File, error)) {
-	if !strings.HasPrefix(name, "/") {
-		name = "/" + name
-	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.files[path.Clean("/"+name)] = fn
+}
+
+// AddBytes adds a file at name with the contents b
+func (d *Dir) AddBytes(name string, b []byte, meta FileMeta) {
+	d.AddGenerator(name, func() ([]byte, error) { return b, nil }, meta)
+}
 
-	d.files[name] = fn
+// AddString adds a file at name with the contents s
+func (d *Dir) AddString(name string, s string, meta FileMeta) {
+	d.AddBytes(name, []byte(s), meta)
+}
+
+// AddTemplate adds a file at name with the contents of t executed with
+// the data returned by fn each time the file is opened
+func (d *Dir) AddTemplate(name string, t *template.Template, fn func() interface{}, meta FileMeta) {
+	d.AddGenerator(name, func() ([]byte, error) {
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, fn()); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}, meta)
+}
+
+// AddGenerator adds a file at name with the contents returned by fn
+// each time the file is opened
+func (d *Dir) AddGenerator(name string, fn func() ([]byte, error), meta FileMeta) {
+	base := path.Base(path.Clean("/" + name))
+
+	d.AddFile(name, func() (http.File, error) {
+		b, err := fn()
+		if err != nil {
+			return nil, err
+		}
+
+		return &memFile{
+			Reader:      bytes.NewReader(b),
+			info:        memFileInfo{name: base, size: int64(len(b)), modTime: meta.ModTime},
+			contentType: meta.ContentType,
+		}, nil
+	})
+}
+
+// RemoveFile removes the file added at name
+func (d *Dir) RemoveFile(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.files, path.Clean("/"+name))
 }
 
 // Open satisfies http.Filesystem
 func (d *Dir) Open(name string) (http.File, error) {
-	if fn, ok := d.files[name]; ok {
+	name = path.Clean("/" + name)
+
+	d.mu.RLock()
+	fn, ok := d.files[name]
+	children := d.children(name)
+	d.mu.RUnlock()
+
+	if ok {
 		return fn()
 	}
 
-	return d.dir.Open(name)
+	f, err := d.dir.Open(name)
+	if len(children) == 0 {
+		return f, err
+	}
+
+	if err != nil {
+		// a directory that only holds added files
+		f = &memFile{
+			Reader: bytes.NewReader(nil),
+			info:   memFileInfo{name: path.Base(name), dir: true},
+		}
+	} else if fi, err := f.Stat(); err != nil || !fi.IsDir() {
+		return f, err
+	}
+
+	return &virtualDir{File: f, dir: d, children: children}, nil
+}
+
+// children returns the names of the added files and directories
+// directly under dir. d.mu must be held.
+func (d *Dir) children(dir string) map[string]string {
+	var (
+		children = map[string]string{}
+		prefix   = strings.TrimSuffix(dir, "/") + "/"
+	)
+
+	for name := range d.files {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		rest := name[len(prefix):]
+		if i := strings.IndexByte(rest, '/'); i != -1 {
+			children[rest[:i]] = prefix + rest[:i]
+		} else {
+			children[rest] = name
+		}
+	}
+
+	return children
+}
+
+// virtualDir is a directory listing the added files and directories
+// under it along with those in the underlying http.FileSystem
+type virtualDir struct {
+	http.File
+	dir      *Dir
+	children map[string]string
+
+	entries []os.FileInfo
+	read    bool
+	pos     int
+}
+
+func (v *virtualDir) Readdir(count int) ([]os.FileInfo, error) {
+	if !v.read {
+		if err := v.list(); err != nil {
+			return nil, err
+		}
+		v.read = true
+	}
+
+	rest := v.entries[v.pos:]
+	if count <= 0 {
+		v.pos = len(v.entries)
+		return rest, nil
+	}
+
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+
+	if count > len(rest) {
+		count = len(rest)
+	}
+	v.pos += count
+	return rest[:count], nil
+}
+
+func (v *virtualDir) list() error {
+	fis, err := v.File.Readdir(-1)
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range fis {
+		if _, ok := v.children[fi.Name()]; !ok {
+			v.entries = append(v.entries, fi)
+		}
+	}
+
+	for _, name := range v.children {
+		f, err := v.dir.Open(name)
+		if err != nil {
+			return err
+		}
+
+		fi, err := f.Stat()
+		f.Close()
+		if err != nil {
+			return err
+		}
+
+		v.entries = append(v.entries, fi)
+	}
+
+	sort.Slice(v.entries, func(i, j int) bool {
+		return v.entries[i].Name() < v.entries[j].Name()
+	})
+
+	return nil
+}
+
+// memFile is an http.File served from memory
+type memFile struct {
+	*bytes.Reader
+	info        memFileInfo
+	contentType string
+}
+
+func (f *memFile) Close() error               { return nil }
+func (f *memFile) Stat() (os.FileInfo, error) { return f.info, nil }
+
+func (f *memFile) Readdir(int) ([]os.FileInfo, error) {
+	if f.info.dir {
+		return nil, nil
+	}
+	return nil, errNotDir
+}
+
+// ContentType returns the content type the file was added with
+func (f *memFile) ContentType() string { return f.contentType }
+
+type memFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (fi memFileInfo) Name() string       { return fi.name }
+func (fi memFileInfo) Size() int64        { return fi.size }
+func (fi memFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi memFileInfo) IsDir() bool        { return fi.dir }
+func (fi memFileInfo) Sys() interface{}   { return nil }
+
+func (fi memFileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0555
+	}
+	return 0444
 }
 
 // ReadFile reads file contents from the file name in fs
@@ -0,0 +1,172 @@
+package httpsrv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jonasi/ctxlog"
+)
+
+// ErrMissingValue is returned when a required request value is not present
+var ErrMissingValue = errors.New("missing value")
+
+// StatusCoder is implemented by errors that map to an http status code
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// ErrorStatus returns the http status code associated with err,
+// defaulting to 500
+func ErrorStatus(err error) int {
+	var sc StatusCoder
+	if errors.As(err, &sc) {
+		return sc.StatusCode()
+	}
+
+	return http.StatusInternalServerError
+}
+
+// ParamError is returned when a request value is missing or cannot
+// be converted to the requested type
+type ParamError struct {
+	Source string
+	Key    string
+	Value  string
+	Err    error
+}
+
+func (e *ParamError) Error() string {
+	if e.Source == "" && e.Key == "" {
+		if e.Err == ErrMissingValue {
+			return "missing value"
+		}
+		return fmt.Sprintf("invalid value %q: %s", e.Value, e.Err)
+	}
+
+	if e.Key == "" {
+		return fmt.Sprintf("invalid %s: %s", e.Source, e.Err)
+	}
+
+	if e.Err == ErrMissingValue {
+		return fmt.Sprintf("missing %s value %q", e.Source, e.Key)
+	}
+
+	return fmt.Sprintf("invalid %s value %q: %s", e.Source, e.Key, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *ParamError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode satisfies StatusCoder
+func (e *ParamError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// MarshalJSON renders e as the source, key and message of the failure
+func (e *ParamError) MarshalJSON() ([]byte, error) {
+	var (
+		msg    = e.Err.Error()
+		numErr *strconv.NumError
+	)
+
+	switch {
+	case e.Err == ErrMissingValue:
+		msg = "is required"
+	case errors.As(e.Err, &numErr):
+		msg = numErr.Err.Error()
+	}
+
+	return json.Marshal(struct {
+		Source string `json:"source"`
+		Key    string `json:"key,omitempty"`
+		Value  string `json:"value,omitempty"`
+		Error  string `json:"error"`
+	}{e.Source, e.Key, e.Value, msg})
+}
+
+// errorResponse is the structured body written by WriteError
+type errorResponse struct {
+	Status int           `json:"status"`
+	Error  string        `json:"error"`
+	Fields []*ParamError `json:"fields,omitempty"`
+}
+
+// WriteError writes err to w as json with the status code found via
+// ErrorStatus. ParamError and ParamErrors list each offending value in
+// fields. Server errors are written with a generic message so internal
+// details are not leaked to the client.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	var (
+		status = ErrorStatus(err)
+		resp   = errorResponse{Status: status, Error: err.Error()}
+		perrs  ParamErrors
+		perr   *ParamError
+	)
+
+	switch {
+	case status >= http.StatusInternalServerError:
+		resp.Error = http.StatusText(status)
+		if span := SpanFromContext(r.Context()); span != nil {
+			span.RecordError(err)
+		}
+	case errors.As(err, &perrs):
+		resp.Error = http.StatusText(status)
+		resp.Fields = perrs
+	case errors.As(err, &perr):
+		resp.Error = http.StatusText(status)
+		resp.Fields = []*ParamError{perr}
+	}
+
+	if err := WriteJSON(w, status, resp); err != nil {
+		ctxlog.Errorf(r.Context(), "Error writing error response: %s", err)
+	}
+}
+
+// ParamErrors collects every ParamError encountered while
+// processing a request
+type ParamErrors []*ParamError
+
+func (e ParamErrors) Error() string {
+	strs := make([]string, len(e))
+	for i, err := range e {
+		strs[i] = err.Error()
+	}
+
+	return strings.Join(strs, "; ")
+}
+
+// StatusCode satisfies StatusCoder
+func (e ParamErrors) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// StatusError is an error with an associated http status code
+type StatusError struct {
+	Status int
+	Err    error
+}
+
+// NewStatusError returns a StatusError for err
+func NewStatusError(status int, err error) *StatusError {
+	return &StatusError{Status: status, Err: err}
+}
+
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode satisfies StatusCoder
+func (e *StatusError) StatusCode() int {
+	return e.Status
+}
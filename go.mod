@@ -1,20 +1,29 @@
 module github.com/jonasi/httpsrv
 
-go 1.13
+go 1.18
 
 require (
-	github.com/facebookgo/clock v0.0.0-20150410010913-600d898af40a // indirect
-	github.com/fastly/go-utils v0.0.0-20180712184237-d95a45783239 // indirect
-	github.com/jehiah/go-strftime v0.0.0-20171201141054-1d33003b3869 // indirect
+	github.com/andybalholm/brotli v1.0.5
 	github.com/jonasi/ctxlog v0.0.0-20200226144409-2fe3891a31c6
 	github.com/jonasi/svc v0.0.0-20200227155810-7d0f31db0a8a
 	github.com/julienschmidt/httprouter v1.3.0
-	github.com/kr/pretty v0.2.0 // indirect
+	github.com/klauspost/compress v1.15.15
 	github.com/lestrrat-go/apache-logformat v2.0.4+incompatible
+	github.com/satori/go.uuid v1.2.0
+	golang.org/x/net v0.0.0-20200219183655-46282727080f
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/facebookgo/clock v0.0.0-20150410010913-600d898af40a // indirect
+	github.com/fastly/go-utils v0.0.0-20180712184237-d95a45783239 // indirect
+	github.com/jehiah/go-strftime v0.0.0-20171201141054-1d33003b3869 // indirect
+	github.com/kr/pretty v0.2.0 // indirect
 	github.com/lestrrat-go/strftime v1.0.1 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
-	github.com/satori/go.uuid v1.2.0
 	github.com/tebeka/strftime v0.1.3 // indirect
-	golang.org/x/net v0.0.0-20200219183655-46282727080f
+	go.uber.org/atomic v1.6.0 // indirect
+	go.uber.org/multierr v1.5.0 // indirect
+	golang.org/x/text v0.3.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
 )
@@ -0,0 +1,238 @@
+package httpsrv
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/jonasi/ctxlog"
+)
+
+// DefaultJSONDecoder is used by DecodeJSON
+var DefaultJSONDecoder = &JSONDecoder{
+	MaxBytes:           1 << 20,
+	RequireContentType: true,
+}
+
+// JSONDecoder decodes json request bodies
+type JSONDecoder struct {
+	// MaxBytes limits the size of the body. Zero means no limit.
+	MaxBytes int64
+	// DisallowUnknownFields fails decoding when the body has keys
+	// that do not map to a field in the destination
+	DisallowUnknownFields bool
+	// RequireContentType fails decoding when the request does
+	// not have an application/json content type
+	RequireContentType bool
+}
+
+var (
+	errEmptyBody    = errors.New("empty body")
+	errBodyTooLarge = errors.New("body too large")
+)
+
+// DecodeJSON decodes the json body of r into v with DefaultJSONDecoder
+func DecodeJSON(r *http.Request, v interface{}) error {
+	return DefaultJSONDecoder.Decode(r, v)
+}
+
+// Decode decodes the json body of r into v. Malformed bodies are
+// reported as a ParamError with the offending field or offset.
+func (d *JSONDecoder) Decode(r *http.Request, v interface{}) error {
+	if d.RequireContentType {
+		ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if ct != "application/json" {
+			return NewStatusError(http.StatusUnsupportedMediaType, fmt.Errorf("unsupported content type %q, expected application/json", ct))
+		}
+	}
+
+	if r.Body == nil || r.Body == http.NoBody {
+		return &ParamError{Source: "body", Err: errEmptyBody}
+	}
+
+	var body io.Reader = r.Body
+	if d.MaxBytes > 0 {
+		body = &maxBytesReader{r: r.Body, n: d.MaxBytes}
+	}
+
+	dec := json.NewDecoder(body)
+	if d.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+
+	if err := dec.Decode(v); err != nil {
+		return jsonError(err)
+	}
+
+	// only a single value is allowed in the body
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		if err == errBodyTooLarge {
+			return jsonError(err)
+		}
+		return &ParamError{Source: "body", Err: fmt.Errorf("unexpected data after offset %d", dec.InputOffset())}
+	}
+
+	return nil
+}
+
+func jsonError(err error) error {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+
+	switch {
+	case err == errBodyTooLarge:
+		return NewStatusError(http.StatusRequestEntityTooLarge, err)
+	case err == io.EOF:
+		return &ParamError{Source: "body", Err: errEmptyBody}
+	case err == io.ErrUnexpectedEOF:
+		return &ParamError{Source: "body", Err: errors.New("unexpected end of json")}
+	case errors.As(err, &syntaxErr):
+		return &ParamError{Source: "body", Err: fmt.Errorf("%s at offset %d", syntaxErr, syntaxErr.Offset)}
+	case errors.As(err, &typeErr):
+		return &ParamError{
+			Source: "body",
+			Key:    typeErr.Field,
+			Value:  typeErr.Value,
+			Err:    fmt.Errorf("expected %s at offset %d", typeErr.Type, typeErr.Offset),
+		}
+	}
+
+	// DisallowUnknownFields errors are not typed
+	return &ParamError{Source: "body", Err: err}
+}
+
+// maxBytesReader is like http.MaxBytesReader but returns
+// errBodyTooLarge so the limit can be reported accurately
+type maxBytesReader struct {
+	r io.Reader
+	n int64
+}
+
+func (m *maxBytesReader) Read(p []byte) (int, error) {
+	if m.n <= 0 {
+		// probe for data beyond the limit
+		var b [1]byte
+		if n, _ := m.r.Read(b[:]); n > 0 {
+			return 0, errBodyTooLarge
+		}
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > m.n {
+		p = p[:m.n]
+	}
+
+	n, err := m.r.Read(p)
+	m.n -= int64(n)
+	return n, err
+}
+
+// jsonStreamThreshold is the slice length above which WriteJSON
+// encodes elements one at a time rather than buffering the response
+const jsonStreamThreshold = 1000
+
+// WriteJSON writes v to w as json with the provided status
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) error {
+	return writeJSON(w, status, v, false)
+}
+
+// ServeJSON writes v to w as json with the provided status,
+// indenting the output when r has a pretty query parameter
+func ServeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	pretty := false
+	if p := QueryValues(r, "pretty"); p.Exists() {
+		pretty = p.String() == "" || p.Bool()
+	}
+
+	if err := writeJSON(w, status, v, pretty); err != nil {
+		ctxlog.Errorf(r.Context(), "Error writing json response: %s", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}, pretty bool) error {
+	rv := reflect.ValueOf(v)
+	if !pretty && streamable(rv) {
+		setJSONHeaders(w)
+		w.WriteHeader(status)
+		return streamJSON(w, rv)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if pretty {
+		enc.SetIndent("", "  ")
+	}
+
+	if err := enc.Encode(v); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return err
+	}
+
+	setJSONHeaders(w)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(status)
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func setJSONHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+}
+
+// streamable reports whether rv is a large slice encoded as a json
+// array. []byte is encoded as base64 and json.Marshaler types encode
+// themselves, so neither is streamed.
+func streamable(rv reflect.Value) bool {
+	if rv.Kind() != reflect.Slice || rv.Len() <= jsonStreamThreshold {
+		return false
+	}
+
+	t := rv.Type()
+	if t.Elem().Kind() == reflect.Uint8 {
+		return false
+	}
+
+	return !t.Implements(jsonMarshalerType) && !reflect.PtrTo(t).Implements(jsonMarshalerType)
+}
+
+// streamJSON writes the slice rv element by element. The status has
+// already been sent, so encoding errors can only be returned.
+func streamJSON(w io.Writer, rv reflect.Value) error {
+	var (
+		buf bytes.Buffer
+		enc = json.NewEncoder(&buf)
+	)
+
+	buf.WriteByte('[')
+	for i := 0; i < rv.Len(); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		if err := enc.Encode(rv.Index(i).Interface()); err != nil {
+			return err
+		}
+
+		// drop the trailing newline written by Encode
+		buf.Truncate(buf.Len() - 1)
+
+		if buf.Len() >= 32<<10 {
+			if _, err := buf.WriteTo(w); err != nil {
+				return err
+			}
+		}
+	}
+	buf.WriteString("]\n")
+
+	_, err := buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,412 @@
+package httpsrv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ManifestFormat is the format of the asset manifest emitted by a
+// bundler
+type ManifestFormat string
+
+// Supported manifest formats
+const (
+	// ManifestJSON is a json object of objects passed as is to
+	// SPAConf.IndexTemplateData
+	ManifestJSON    ManifestFormat = ""
+	ManifestVite    ManifestFormat = "vite"
+	ManifestWebpack ManifestFormat = "webpack"
+	ManifestEsbuild ManifestFormat = "esbuild"
+)
+
+// Entrypoint is a bundle entrypoint and the files needed to load it
+type Entrypoint struct {
+	Name     string
+	Scripts  []string
+	Styles   []string
+	Preloads []string
+	// Module is true if scripts must be loaded as es modules
+	Module bool
+}
+
+// Manifest is a bundler manifest normalised into entrypoints
+type Manifest struct {
+	// Base is prepended to relative file paths in rendered tags
+	Base        string
+	Entrypoints map[string]*Entrypoint
+}
+
+// ParseManifest parses the manifest b in the format f
+func ParseManifest(f ManifestFormat, b []byte) (*Manifest, error) {
+	switch f {
+	case ManifestVite:
+		return ParseViteManifest(b)
+	case ManifestWebpack:
+		return ParseWebpackManifest(b)
+	case ManifestEsbuild:
+		return ParseEsbuildMetafile(b)
+	}
+
+	return nil, fmt.Errorf("unsupported manifest format %q", f)
+}
+
+type viteChunk struct {
+	File           string   `json:"file"`
+	Name           string   `json:"name"`
+	Src            string   `json:"src"`
+	IsEntry        bool     `json:"isEntry"`
+	CSS            []string `json:"css"`
+	Imports        []string `json:"imports"`
+	DynamicImports []string `json:"dynamicImports"`
+}
+
+// ParseViteManifest parses a vite manifest.json. Entrypoints are named
+// by their source path, e.g. src/main.ts, and by their chunk name.
+func ParseViteManifest(b []byte) (*Manifest, error) {
+	var chunks map[string]*viteChunk
+	if err := json.Unmarshal(b, &chunks); err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{Entrypoints: map[string]*Entrypoint{}}
+	for key, c := range chunks {
+		if !c.IsEntry {
+			continue
+		}
+
+		e := &Entrypoint{Name: key, Scripts: []string{c.File}, Module: true}
+		if strings.HasSuffix(c.File, ".css") {
+			e.Scripts, e.Styles = nil, []string{c.File}
+		}
+		e.Styles = append(e.Styles, c.CSS...)
+
+		// static imports are needed before the entrypoint runs
+		seen := map[string]bool{key: true}
+		var walk func(keys []string)
+		walk = func(keys []string) {
+			for _, k := range keys {
+				imp, ok := chunks[k]
+				if !ok || seen[k] {
+					continue
+				}
+
+				seen[k] = true
+				e.Preloads = append(e.Preloads, imp.File)
+				e.Styles = append(e.Styles, imp.CSS...)
+				walk(imp.Imports)
+			}
+		}
+		walk(c.Imports)
+
+		e.Styles = uniqueStrings(e.Styles)
+		m.Entrypoints[key] = e
+		if c.Name != "" {
+			if _, ok := m.Entrypoints[c.Name]; !ok {
+				m.Entrypoints[c.Name] = e
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// ParseWebpackManifest parses the entrypoints of a webpack stats json
+// or a webpack-assets-manifest written with entrypoints enabled
+func ParseWebpackManifest(b []byte) (*Manifest, error) {
+	var raw struct {
+		PublicPath  string `json:"publicPath"`
+		Entrypoints map[string]struct {
+			Assets json.RawMessage `json:"assets"`
+		} `json:"entrypoints"`
+	}
+
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, err
+	}
+
+	if raw.Entrypoints == nil {
+		return nil, errors.New("webpack manifest has no entrypoints")
+	}
+
+	m := &Manifest{Entrypoints: map[string]*Entrypoint{}}
+	for name, ep := range raw.Entrypoints {
+		files, err := webpackAssets(ep.Assets)
+		if err != nil {
+			return nil, fmt.Errorf("entrypoint %s: %w", name, err)
+		}
+
+		e := &Entrypoint{Name: name}
+		for _, f := range files {
+			if raw.PublicPath != "" && raw.PublicPath != "auto" && !isAbsURL(f) {
+				f = strings.TrimSuffix(raw.PublicPath, "/") + "/" + strings.TrimPrefix(f, "/")
+			}
+
+			switch path.Ext(f) {
+			case ".js", ".mjs":
+				e.Scripts = append(e.Scripts, f)
+			case ".css":
+				e.Styles = append(e.Styles, f)
+			}
+		}
+
+		m.Entrypoints[name] = e
+	}
+
+	return m, nil
+}
+
+// webpackAssets returns the files of an entrypoint, which are either a
+// list of names or objects with a name in stats, or lists keyed by
+// extension in webpack-assets-manifest
+func webpackAssets(b json.RawMessage) ([]string, error) {
+	var byExt map[string][]string
+	if err := json.Unmarshal(b, &byExt); err == nil {
+		files := []string{}
+		for _, ext := range []string{"js", "mjs", "css"} {
+			files = append(files, byExt[ext]...)
+		}
+		return files, nil
+	}
+
+	var list []json.RawMessage
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(list))
+	for _, item := range list {
+		var name string
+		if err := json.Unmarshal(item, &name); err == nil {
+			files = append(files, name)
+			continue
+		}
+
+		var obj struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(item, &obj); err != nil {
+			return nil, err
+		}
+		files = append(files, obj.Name)
+	}
+
+	return files, nil
+}
+
+// ParseEsbuildMetafile parses an esbuild metafile. Entrypoints are named
+// by their source path, e.g. src/main.ts, and by its base name without
+// extension. Output paths are made relative to their common directory.
+func ParseEsbuildMetafile(b []byte) (*Manifest, error) {
+	var meta struct {
+		Outputs map[string]struct {
+			EntryPoint string `json:"entryPoint"`
+			CSSBundle  string `json:"cssBundle"`
+			Imports    []struct {
+				Path string `json:"path"`
+				Kind string `json:"kind"`
+			} `json:"imports"`
+		} `json:"outputs"`
+	}
+
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return nil, err
+	}
+
+	outputs := make([]string, 0, len(meta.Outputs))
+	for out := range meta.Outputs {
+		outputs = append(outputs, out)
+	}
+	sort.Strings(outputs)
+
+	var (
+		m   = &Manifest{Entrypoints: map[string]*Entrypoint{}}
+		dir = commonDir(outputs)
+		rel = func(p string) string { return strings.TrimPrefix(p, dir) }
+	)
+
+	for _, out := range outputs {
+		o := meta.Outputs[out]
+		if o.EntryPoint == "" || strings.HasSuffix(out, ".map") {
+			continue
+		}
+
+		e := &Entrypoint{Name: o.EntryPoint, Module: true}
+		if strings.HasSuffix(out, ".css") {
+			e.Styles = append(e.Styles, rel(out))
+		} else {
+			e.Scripts = append(e.Scripts, rel(out))
+		}
+		if o.CSSBundle != "" {
+			e.Styles = append(e.Styles, rel(o.CSSBundle))
+		}
+
+		seen := map[string]bool{out: true}
+		var walk func(p string)
+		walk = func(p string) {
+			for _, imp := range meta.Outputs[p].Imports {
+				if imp.Kind != "import-statement" || seen[imp.Path] {
+					continue
+				}
+				if _, ok := meta.Outputs[imp.Path]; !ok {
+					continue
+				}
+
+				seen[imp.Path] = true
+				e.Preloads = append(e.Preloads, rel(imp.Path))
+				walk(imp.Path)
+			}
+		}
+		walk(out)
+
+		// a js and css entrypoint can share a source name
+		if prev, ok := m.Entrypoints[o.EntryPoint]; ok {
+			prev.Scripts = uniqueStrings(append(prev.Scripts, e.Scripts...))
+			prev.Styles = uniqueStrings(append(prev.Styles, e.Styles...))
+			prev.Preloads = uniqueStrings(append(prev.Preloads, e.Preloads...))
+			continue
+		}
+
+		m.Entrypoints[o.EntryPoint] = e
+		short := strings.TrimSuffix(path.Base(o.EntryPoint), path.Ext(o.EntryPoint))
+		if _, ok := m.Entrypoints[short]; !ok {
+			m.Entrypoints[short] = e
+		}
+	}
+
+	return m, nil
+}
+
+// commonDir returns the directory, with a trailing slash, shared by
+// every path in paths
+func commonDir(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+
+	dir := path.Dir(paths[0]) + "/"
+	for _, p := range paths[1:] {
+		for !strings.HasPrefix(p, dir) {
+			if dir == "./" || dir == "/" {
+				return ""
+			}
+			dir = path.Dir(strings.TrimSuffix(dir, "/")) + "/"
+		}
+	}
+
+	if dir == "./" {
+		return ""
+	}
+	return dir
+}
+
+func uniqueStrings(strs []string) []string {
+	var (
+		out  = []string{}
+		seen = map[string]bool{}
+	)
+
+	for _, s := range strs {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+
+	return out
+}
+
+func isAbsURL(p string) bool {
+	return strings.HasPrefix(p, "/") || strings.Contains(p, "://")
+}
+
+// URL returns the url of the file p in m
+func (m *Manifest) URL(p string) string {
+	if isAbsURL(p) {
+		return p
+	}
+
+	return m.Base + p
+}
+
+// Entrypoint returns the named entrypoint
+func (m *Manifest) Entrypoint(name string) (*Entrypoint, error) {
+	if m == nil {
+		return nil, errors.New("no asset manifest loaded")
+	}
+
+	e, ok := m.Entrypoints[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown entrypoint %q", name)
+	}
+
+	return e, nil
+}
+
+// ManifestFuncs returns template funcs rendering the tags to load the
+// entrypoints in m:
+//
+//	{{ scripts "main" }}  script tags
+//	{{ styles "main" }}   stylesheet links
+//	{{ preloads "main" }} preload links for imported chunks
+//	{{ entrypoint "main" }}
+//
+// Templates used as SPAConf.IndexTemplate should be parsed with
+// ManifestFuncs(nil) so the funcs are defined. SPAConf replaces them
+// with the funcs for the loaded manifest.
+func ManifestFuncs(m *Manifest) template.FuncMap {
+	tags := func(name string, fn func(*Entrypoint, *strings.Builder)) (template.HTML, error) {
+		e, err := m.Entrypoint(name)
+		if err != nil {
+			return "", err
+		}
+
+		var b strings.Builder
+		fn(e, &b)
+		return template.HTML(b.String()), nil
+	}
+
+	attr := template.HTMLEscapeString
+
+	return template.FuncMap{
+		"entrypoint": m.Entrypoint,
+		"scripts": func(name string) (template.HTML, error) {
+			return tags(name, func(e *Entrypoint, b *strings.Builder) {
+				for _, s := range e.Scripts {
+					if e.Module {
+						fmt.Fprintf(b, `<script type="module" src="%s"></script>`, attr(m.URL(s)))
+					} else {
+						fmt.Fprintf(b, `<script defer src="%s"></script>`, attr(m.URL(s)))
+					}
+				}
+			})
+		},
+		"styles": func(name string) (template.HTML, error) {
+			return tags(name, func(e *Entrypoint, b *strings.Builder) {
+				for _, s := range e.Styles {
+					fmt.Fprintf(b, `<link rel="stylesheet" href="%s">`, attr(m.URL(s)))
+				}
+			})
+		},
+		"preloads": func(name string) (template.HTML, error) {
+			return tags(name, func(e *Entrypoint, b *strings.Builder) {
+				rel := "preload"
+				if e.Module {
+					rel = "modulepreload"
+				}
+
+				for _, s := range e.Preloads {
+					if e.Module {
+						fmt.Fprintf(b, `<link rel="%s" href="%s">`, rel, attr(m.URL(s)))
+					} else {
+						fmt.Fprintf(b, `<link rel="%s" href="%s" as="script">`, rel, attr(m.URL(s)))
+					}
+				}
+			})
+		},
+	}
+}
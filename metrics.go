@@ -0,0 +1,262 @@
+package httpsrv
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBuckets are the default request latency histogram
+// buckets, in seconds
+var DefaultLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultSizeBuckets are the default response size histogram
+// buckets, in bytes
+var DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1e6, 1e7}
+
+// NewMetrics returns an initialized *Metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		Path:           "/metrics",
+		LatencyBuckets: DefaultLatencyBuckets,
+		SizeBuckets:    DefaultSizeBuckets,
+	}
+}
+
+// Metrics records request metrics and exposes them in the prometheus
+// text format. Requests are labelled with their route pattern rather
+// than the raw path to keep label cardinality bounded.
+type Metrics struct {
+	// Path the exposition route is registered at by Init
+	Path string
+	// LatencyBuckets and SizeBuckets are the histogram bucket bounds
+	LatencyBuckets []float64
+	SizeBuckets    []float64
+
+	once     sync.Once
+	mw       Middleware
+	requests *metricVec
+	latency  *metricVec
+	size     *metricVec
+	inFlight *metricVec
+	servers  []*Server
+}
+
+func (m *Metrics) init() {
+	m.once.Do(func() {
+		m.requests = newMetricVec("http_requests_total", "Total number of http requests.", "counter", nil)
+		m.latency = newMetricVec("http_request_duration_seconds", "Latency of http requests.", "histogram", m.LatencyBuckets)
+		m.size = newMetricVec("http_response_size_bytes", "Size of http responses.", "histogram", m.SizeBuckets)
+		m.inFlight = newMetricVec("http_requests_in_flight", "Number of http requests being served.", "gauge", nil)
+		m.mw = MiddlewareFunc("metrics", m.handler)
+	})
+}
+
+// Init registers the metrics middleware and exposition route with s
+// and reports its listener and connection counts
+func (m *Metrics) Init(s *Server) error {
+	m.init()
+	m.servers = append(m.servers, s)
+
+	s.AddMiddleware(m.Middleware())
+	s.Handle(&Route{
+		Method:     "GET",
+		Path:       m.Path,
+		Handler:    m.Handler(),
+		Middleware: []Middleware{SkipMiddleware(m.Middleware())},
+		Doc:        &RouteDoc{Hidden: true},
+		Priority:   PriorityCritical,
+	})
+
+	return nil
+}
+
+// Middleware returns the Middleware recording request metrics
+func (m *Metrics) Middleware() Middleware {
+	m.init()
+	return m.mw
+}
+
+func (m *Metrics) handler(method, path string, h http.Handler) http.Handler {
+	if path == "" {
+		path = "not_found"
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			start  = time.Now()
+			rw     = wrapResponseWriter(w)
+			method = metricMethod(r.Method)
+			flight = []string{method, path}
+		)
+
+		m.inFlight.add(flight, 1)
+		defer func() {
+			m.inFlight.add(flight, -1)
+
+			status := rw.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			labels := []string{method, path, strconv.Itoa(status/100) + "xx"}
+			m.requests.add(labels, 1)
+			m.latency.observe(labels, time.Since(start).Seconds())
+			m.size.observe(labels, float64(rw.Written()))
+		}()
+
+		h.ServeHTTP(rw, r)
+	})
+}
+
+// metricMethod bounds the method label to the known http methods
+func metricMethod(method string) string {
+	for _, m := range allMethods {
+		if m == method {
+			return m
+		}
+	}
+
+	return "OTHER"
+}
+
+// Handler returns an http.Handler serving the metrics in the
+// prometheus text exposition format
+func (m *Metrics) Handler() http.Handler {
+	m.init()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+
+		m.requests.write(&buf, "method", "route", "status")
+		m.latency.write(&buf, "method", "route", "status")
+		m.size.write(&buf, "method", "route", "status")
+		m.inFlight.write(&buf, "method", "route")
+
+		if len(m.servers) > 0 {
+			var listeners, conns int64
+			for _, s := range m.servers {
+				listeners += s.Listeners()
+				conns += s.OpenConns()
+			}
+
+			writeGauge(&buf, "http_server_listeners", "Number of active listeners.", listeners)
+			writeGauge(&buf, "http_server_open_connections", "Number of open connections.", conns)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = buf.WriteTo(w)
+	})
+}
+
+func writeGauge(buf *bytes.Buffer, name, help string, v int64) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", name, help, name, name, v)
+}
+
+// metricVec is a metric partitioned by label values
+type metricVec struct {
+	name, help, typ string
+	buckets         []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labels []string
+	value  float64
+	counts []uint64
+	count  uint64
+}
+
+func newMetricVec(name, help, typ string, buckets []float64) *metricVec {
+	return &metricVec{name: name, help: help, typ: typ, buckets: buckets, series: map[string]*series{}}
+}
+
+func (v *metricVec) get(labels []string) *series {
+	key := strings.Join(labels, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labels: labels, counts: make([]uint64, len(v.buckets))}
+		v.series[key] = s
+	}
+	return s
+}
+
+func (v *metricVec) add(labels []string, n float64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.get(labels).value += n
+}
+
+func (v *metricVec) observe(labels []string, n float64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	s := v.get(labels)
+	s.value += n
+	s.count++
+	for i, b := range v.buckets {
+		if n <= b {
+			s.counts[i]++
+		}
+	}
+}
+
+func (v *metricVec) write(buf *bytes.Buffer, names ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.typ)
+
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		var (
+			s      = v.series[k]
+			labels = formatLabels(names, s.labels)
+		)
+
+		if v.typ != "histogram" {
+			fmt.Fprintf(buf, "%s{%s} %s\n", v.name, labels, formatFloat(s.value))
+			continue
+		}
+
+		for i, b := range v.buckets {
+			fmt.Fprintf(buf, "%s_bucket{%s,le=\"%s\"} %d\n", v.name, labels, formatFloat(b), s.counts[i])
+		}
+		fmt.Fprintf(buf, "%s_bucket{%s,le=\"+Inf\"} %d\n", v.name, labels, s.count)
+		fmt.Fprintf(buf, "%s_sum{%s} %s\n", v.name, labels, formatFloat(s.value))
+		fmt.Fprintf(buf, "%s_count{%s} %d\n", v.name, labels, s.count)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, vals []string) string {
+	parts := make([]string, len(names))
+	for i, n := range names {
+		parts[i] = n + `="` + labelEscaper.Replace(vals[i]) + `"`
+	}
+	return strings.Join(parts, ",")
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -81,6 +81,24 @@ func SkipMiddleware(smws ...Middleware) Middleware {
 	})
 }
 
+// replacingMiddleware returns a Middleware with the given id that
+// removes any other middleware with the same id, so one registered on
+// a route replaces one registered globally
+func replacingMiddleware(id string, fn func(method, path string, h http.Handler) http.Handler) Middleware {
+	return &mwf{
+		mw: mw{id: id, mk: fn},
+		filter: func(mws []Middleware) []Middleware {
+			filtered := []Middleware{}
+			for _, m := range mws {
+				if m.ID() != id {
+					filtered = append(filtered, m)
+				}
+			}
+			return filtered
+		},
+	}
+}
+
 // AccessLogger logs to w when requests come in the apache log format
 func AccessLogger(w io.Writer) Middleware {
 	return MiddlewareFunc("access_logger", func(method, path string, h http.Handler) http.Handler {
@@ -0,0 +1,459 @@
+package httpsrv
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// binaryWriter writes the values of a self describing binary format,
+// e.g. msgpack or cbor
+type binaryWriter interface {
+	writeNil()
+	writeBool(bool)
+	writeInt(int64)
+	writeUint(uint64)
+	writeFloat(f float64, bits int)
+	writeString(string)
+	writeBytes([]byte)
+	writeArrayHead(n int)
+	writeMapHead(n int)
+}
+
+var jsonNumberType = reflect.TypeOf(json.Number(""))
+
+// writeBinary walks v with reflection and writes it to w. Struct fields
+// are named and omitted following their json tags, json.Marshaler
+// output is written as the value it decodes to and []byte is written
+// as binary.
+func writeBinary(w binaryWriter, v reflect.Value) error {
+	if !v.IsValid() {
+		w.writeNil()
+		return nil
+	}
+
+	t := v.Type()
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		w.writeNil()
+		return nil
+	}
+
+	switch {
+	case t == jsonNumberType:
+		return writeBinaryNumber(w, json.Number(v.String()))
+	case implements(v, jsonMarshalerType):
+		b, err := addrIfNeeded(v, jsonMarshalerType).Interface().(json.Marshaler).MarshalJSON()
+		if err != nil {
+			return err
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+
+		var g interface{}
+		if err := dec.Decode(&g); err != nil {
+			return err
+		}
+		return writeBinary(w, reflect.ValueOf(g))
+	case implements(v, textMarshalerType):
+		b, err := addrIfNeeded(v, textMarshalerType).Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		w.writeString(string(b))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return writeBinary(w, v.Elem())
+	case reflect.Bool:
+		w.writeBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		w.writeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		w.writeUint(v.Uint())
+	case reflect.Float32:
+		w.writeFloat(v.Float(), 32)
+	case reflect.Float64:
+		w.writeFloat(v.Float(), 64)
+	case reflect.String:
+		w.writeString(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			w.writeBytes(v.Bytes())
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		w.writeArrayHead(v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if err := writeBinary(w, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+		return writeBinaryMap(w, v)
+	case reflect.Struct:
+		return writeBinaryStruct(w, v)
+	default:
+		return fmt.Errorf("unsupported type %s", t)
+	}
+
+	return nil
+}
+
+// implements reports whether v, or its address when v is
+// addressable, implements iface
+func implements(v reflect.Value, iface reflect.Type) bool {
+	return v.Type().Implements(iface) || (v.CanAddr() && reflect.PtrTo(v.Type()).Implements(iface))
+}
+
+func addrIfNeeded(v reflect.Value, iface reflect.Type) reflect.Value {
+	if v.Type().Implements(iface) {
+		return v
+	}
+	return v.Addr()
+}
+
+func writeBinaryNumber(w binaryWriter, n json.Number) error {
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		w.writeInt(i)
+		return nil
+	}
+	if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+		w.writeUint(u)
+		return nil
+	}
+
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil {
+		return err
+	}
+	w.writeFloat(f, 64)
+	return nil
+}
+
+// writeBinaryMap writes v with its keys converted to strings like
+// encoding/json, in sorted order
+func writeBinaryMap(w binaryWriter, v reflect.Value) error {
+	var (
+		keys = make([]string, 0, v.Len())
+		vals = make(map[string]reflect.Value, v.Len())
+	)
+
+	for it := v.MapRange(); it.Next(); {
+		k, err := mapKeyString(it.Key())
+		if err != nil {
+			return err
+		}
+		keys = append(keys, k)
+		vals[k] = it.Value()
+	}
+	sort.Strings(keys)
+
+	w.writeMapHead(len(keys))
+	for _, k := range keys {
+		w.writeString(k)
+		if err := writeBinary(w, vals[k]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func mapKeyString(k reflect.Value) (string, error) {
+	if k.Kind() == reflect.String {
+		return k.String(), nil
+	}
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		b, err := tm.MarshalText()
+		return string(b), err
+	}
+
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+
+	return "", fmt.Errorf("unsupported map key type %s", k.Type())
+}
+
+type binaryField struct {
+	name      string
+	v         reflect.Value
+	omitEmpty bool
+	depth     int
+}
+
+func writeBinaryStruct(w binaryWriter, v reflect.Value) error {
+	var fields []binaryField
+	for _, f := range structFields(v) {
+		if f.omitEmpty && isEmptyValue(f.v) {
+			continue
+		}
+		fields = append(fields, f)
+	}
+
+	w.writeMapHead(len(fields))
+	for _, f := range fields {
+		w.writeString(f.name)
+		if err := writeBinary(w, f.v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// structFields returns the fields of v named by their json tags in
+// declaration order, flattening embedded structs. Like encoding/json,
+// a field hides fields of the same name nested deeper in v.
+func structFields(v reflect.Value) []binaryField {
+	var (
+		all     = collectFields(v, 0)
+		depths  = map[string]int{}
+		written = map[string]bool{}
+		out     []binaryField
+	)
+
+	for _, f := range all {
+		if d, ok := depths[f.name]; !ok || f.depth < d {
+			depths[f.name] = f.depth
+		}
+	}
+
+	for _, f := range all {
+		if f.depth == depths[f.name] && !written[f.name] {
+			written[f.name] = true
+			out = append(out, f)
+		}
+	}
+
+	return out
+}
+
+func collectFields(v reflect.Value, depth int) []binaryField {
+	var (
+		t      = v.Type()
+		fields []binaryField
+	)
+
+	for i := 0; i < t.NumField(); i++ {
+		var (
+			f      = t.Field(i)
+			tag, _ = f.Tag.Lookup("json")
+			opts   = strings.Split(tag, ",")
+			name   = opts[0]
+		)
+
+		if tag == "-" {
+			continue
+		}
+
+		if f.Anonymous && name == "" {
+			fv := v.Field(i)
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() || fv.Type().Elem().Kind() != reflect.Struct {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				fields = append(fields, collectFields(fv, depth+1)...)
+				continue
+			}
+		}
+
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		bf := binaryField{name: name, v: v.Field(i), depth: depth}
+		for _, o := range opts[1:] {
+			bf.omitEmpty = bf.omitEmpty || o == "omitempty"
+		}
+		fields = append(fields, bf)
+	}
+
+	return fields
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+
+	return false
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func encodeMsgpack(w io.Writer, v interface{}) error {
+	var buf msgpackWriter
+	if err := writeBinary(&buf, reflect.ValueOf(v)); err != nil {
+		return fmt.Errorf("msgpack: %w", err)
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// msgpackWriter writes values in the msgpack format,
+// https://github.com/msgpack/msgpack/blob/master/spec.md
+type msgpackWriter struct {
+	bytes.Buffer
+}
+
+func (m *msgpackWriter) writeNil() {
+	m.WriteByte(0xc0)
+}
+
+func (m *msgpackWriter) writeBool(b bool) {
+	if b {
+		m.WriteByte(0xc3)
+	} else {
+		m.WriteByte(0xc2)
+	}
+}
+
+func (m *msgpackWriter) writeInt(n int64) {
+	switch {
+	case n >= 0:
+		m.writeUint(uint64(n))
+	case n >= -32:
+		m.WriteByte(byte(int8(n)))
+	case n >= math.MinInt8:
+		m.Write([]byte{0xd0, byte(int8(n))})
+	case n >= math.MinInt16:
+		m.WriteByte(0xd1)
+		_ = binary.Write(m, binary.BigEndian, int16(n))
+	case n >= math.MinInt32:
+		m.WriteByte(0xd2)
+		_ = binary.Write(m, binary.BigEndian, int32(n))
+	default:
+		m.WriteByte(0xd3)
+		_ = binary.Write(m, binary.BigEndian, n)
+	}
+}
+
+func (m *msgpackWriter) writeUint(n uint64) {
+	switch {
+	case n < 128:
+		m.WriteByte(byte(n))
+	case n <= math.MaxUint8:
+		m.Write([]byte{0xcc, byte(n)})
+	case n <= math.MaxUint16:
+		m.WriteByte(0xcd)
+		_ = binary.Write(m, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		m.WriteByte(0xce)
+		_ = binary.Write(m, binary.BigEndian, uint32(n))
+	default:
+		m.WriteByte(0xcf)
+		_ = binary.Write(m, binary.BigEndian, n)
+	}
+}
+
+func (m *msgpackWriter) writeFloat(f float64, bits int) {
+	if bits == 32 {
+		m.WriteByte(0xca)
+		_ = binary.Write(m, binary.BigEndian, math.Float32bits(float32(f)))
+		return
+	}
+
+	m.WriteByte(0xcb)
+	_ = binary.Write(m, binary.BigEndian, math.Float64bits(f))
+}
+
+func (m *msgpackWriter) writeString(s string) {
+	switch n := len(s); {
+	case n < 32:
+		m.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		m.Write([]byte{0xd9, byte(n)})
+	case n <= math.MaxUint16:
+		m.WriteByte(0xda)
+		_ = binary.Write(m, binary.BigEndian, uint16(n))
+	default:
+		m.WriteByte(0xdb)
+		_ = binary.Write(m, binary.BigEndian, uint32(n))
+	}
+	m.WriteString(s)
+}
+
+func (m *msgpackWriter) writeBytes(b []byte) {
+	switch n := len(b); {
+	case n <= math.MaxUint8:
+		m.Write([]byte{0xc4, byte(n)})
+	case n <= math.MaxUint16:
+		m.WriteByte(0xc5)
+		_ = binary.Write(m, binary.BigEndian, uint16(n))
+	default:
+		m.WriteByte(0xc6)
+		_ = binary.Write(m, binary.BigEndian, uint32(n))
+	}
+	m.Write(b)
+}
+
+func (m *msgpackWriter) writeArrayHead(n int) {
+	m.writeLen(n, 0x90, 0xdc, 0xdd)
+}
+
+func (m *msgpackWriter) writeMapHead(n int) {
+	m.writeLen(n, 0x80, 0xde, 0xdf)
+}
+
+func (m *msgpackWriter) writeLen(n int, fix, b16, b32 byte) {
+	switch {
+	case n < 16:
+		m.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		m.WriteByte(b16)
+		_ = binary.Write(m, binary.BigEndian, uint16(n))
+	default:
+		m.WriteByte(b32)
+		_ = binary.Write(m, binary.BigEndian, uint32(n))
+	}
+}
@@ -0,0 +1,98 @@
+package httpsrv
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"testing"
+	"time"
+)
+
+type binaryBase struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type binaryValue struct {
+	binaryBase
+	Name    string    `json:"name"`
+	Big     int64     `json:"big"`
+	Max     uint64    `json:"max"`
+	Neg     int       `json:"neg"`
+	Ratio   float32   `json:"ratio"`
+	Score   float64   `json:"score"`
+	Raw     []byte    `json:"raw"`
+	OK      bool      `json:"ok"`
+	Skipped string    `json:"skipped,omitempty"`
+	Ignored string    `json:"-"`
+	Nil     *int      `json:"nil"`
+	At      time.Time `json:"at"`
+	Tags    map[string]int
+	private int
+}
+
+var testBinaryValue = binaryValue{
+	binaryBase: binaryBase{ID: "x", Name: "hidden"},
+	Name:       "n",
+	Big:        1<<53 + 1,
+	Max:        math.MaxUint64,
+	Neg:        -200,
+	Ratio:      0.5,
+	Score:      1.5,
+	Raw:        []byte{1, 2},
+	OK:         true,
+	Ignored:    "ignored",
+	At:         time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	Tags:       map[string]int{"b": 2, "a": 1},
+	private:    1,
+}
+
+func expectEncoding(t *testing.T, enc Encoder, v interface{}, want string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := enc.Encode(&buf, v); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := hex.EncodeToString(buf.Bytes()); got != want {
+		t.Errorf("%s: expected\n%s\ngot\n%s", enc.ContentType(), want, got)
+	}
+}
+
+func TestMsgpackEncoder(t *testing.T) {
+	expectEncoding(t, MsgpackEncoder, testBinaryValue, ""+
+		"8c"+ // map of 12
+		"a26964"+"a178"+ // id: "x"
+		"a46e616d65"+"a16e"+ // name: "n"
+		"a3626967"+"cf0020000000000001"+ // big: 2^53+1
+		"a36d6178"+"cfffffffffffffffff"+ // max: 2^64-1
+		"a36e6567"+"d1ff38"+ // neg: -200
+		"a5726174696f"+"ca3f000000"+ // ratio: float32 0.5
+		"a573636f7265"+"cb3ff8000000000000"+ // score: 1.5
+		"a3726177"+"c4020102"+ // raw: bin 0102
+		"a26f6b"+"c3"+ // ok: true
+		"a36e696c"+"c0"+ // nil: nil
+		"a26174"+"b4323032342d30312d30325430333a30343a30355a"+ // at: "2024-01-02T03:04:05Z"
+		"a454616773"+"82"+"a161"+"01"+"a162"+"02", // Tags: {a: 1, b: 2}
+	)
+}
+
+func TestMsgpackEncoderScalars(t *testing.T) {
+	for _, tt := range []struct {
+		v    interface{}
+		want string
+	}{
+		{nil, "c0"},
+		{[]int{}, "90"},
+		{[]string(nil), "c0"},
+		{-1, "ff"},
+		{-33, "d0df"},
+		{200, "ccc8"},
+		{int64(math.MinInt64), "d38000000000000000"},
+		{[3]int8{1, -1, 0}, "9301ff00"},
+		{map[int]bool{10: true, 2: false}, "82a23130c3a132c2"},
+	} {
+		expectEncoding(t, MsgpackEncoder, tt.v, tt.want)
+	}
+}
@@ -0,0 +1,664 @@
+package httpsrv
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OpenAPIInfo is the info object of a generated OpenAPI document
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// OpenAPI generates an OpenAPI 3.1 document describing the routes
+// registered with s. Routes with a "*" method or a hidden RouteDoc are
+// excluded.
+func (s *Server) OpenAPI(info OpenAPIInfo) map[string]interface{} {
+	var (
+		g     = newSchemaGen()
+		paths = map[string]interface{}{}
+		rts   = append(routes{}, s.routes...)
+	)
+
+	sort.Sort(rts)
+	for _, rt := range rts {
+		if rt.Method == "*" || (rt.Doc != nil && rt.Doc.Hidden) {
+			continue
+		}
+
+		path := OpenAPIPath(rt.Path)
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			item = map[string]interface{}{}
+			paths[path] = item
+		}
+
+		item[strings.ToLower(rt.Method)] = g.operation(rt)
+	}
+
+	g.components["Error"] = errorSchema
+
+	return map[string]interface{}{
+		"openapi": "3.1.0",
+		"info":    info,
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": g.components,
+		},
+	}
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+var pathParamRe = regexp.MustCompile(`[:*]([^/]+)`)
+
+// OpenAPIPath converts an httprouter path, e.g. /users/:id/*splat, to
+// its OpenAPI form, /users/{id}/{splat}
+func OpenAPIPath(path string) string {
+	return pathParamRe.ReplaceAllString(path, "{$1}")
+}
+
+// OpenAPIRoute returns a Route that serves the OpenAPI document for
+// the server handling the request. Paths ending in .yaml or .yml are
+// served as YAML, otherwise JSON is served. The document is generated
+// on the first request.
+func OpenAPIRoute(path string, info OpenAPIInfo, mws ...Middleware) *Route {
+	var (
+		once sync.Once
+		doc  []byte
+		err  error
+		yml  = strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml")
+	)
+
+	return &Route{
+		Method:     "GET",
+		Path:       path,
+		Middleware: mws,
+		Doc:        &RouteDoc{Hidden: true},
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			once.Do(func() {
+				s := ServerFromContext(r.Context())
+				if s == nil {
+					s = &Server{}
+				}
+
+				d := s.OpenAPI(info)
+				if yml {
+					doc, err = MarshalYAML(d)
+				} else {
+					doc, err = json.MarshalIndent(d, "", "  ")
+				}
+			})
+
+			if err != nil {
+				WriteError(w, r, err)
+				return
+			}
+
+			ct := "application/json"
+			if yml {
+				ct = "application/yaml"
+			}
+
+			w.Header().Set("Content-Type", ct)
+			w.Header().Set("Content-Length", strconv.Itoa(len(doc)))
+			_, _ = w.Write(doc)
+		}),
+	}
+}
+
+var errorSchema = map[string]interface{}{
+	"type":     "object",
+	"required": []string{"status", "error"},
+	"properties": map[string]interface{}{
+		"status": map[string]interface{}{"type": "integer"},
+		"error":  map[string]interface{}{"type": "string"},
+		"fields": map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type":     "object",
+				"required": []string{"source", "error"},
+				"properties": map[string]interface{}{
+					"source": map[string]interface{}{"type": "string"},
+					"key":    map[string]interface{}{"type": "string"},
+					"value":  map[string]interface{}{"type": "string"},
+					"error":  map[string]interface{}{"type": "string"},
+				},
+			},
+		},
+	},
+}
+
+// routeTypes returns the request and response types documented for rt
+func routeTypes(rt *Route) (req, resp reflect.Type) {
+	if th, ok := rt.Handler.(TypedHandler); ok {
+		req, resp = th.RequestType(), th.ResponseType()
+	}
+
+	if rt.Doc != nil && rt.Doc.Request != nil {
+		req = reflect.TypeOf(rt.Doc.Request)
+	}
+	if rt.Doc != nil && rt.Doc.Response != nil {
+		resp = reflect.TypeOf(rt.Doc.Response)
+	}
+
+	return req, resp
+}
+
+type schemaGen struct {
+	components map[string]interface{}
+	// names are the component names given to each type and types the
+	// type holding each name, so types sharing a name get distinct ones
+	names map[reflect.Type]string
+	types map[string]reflect.Type
+}
+
+func newSchemaGen() *schemaGen {
+	return &schemaGen{
+		components: map[string]interface{}{},
+		names:      map[reflect.Type]string{},
+		types:      map[string]reflect.Type{},
+	}
+}
+
+func (g *schemaGen) operation(rt *Route) map[string]interface{} {
+	var (
+		op        = map[string]interface{}{}
+		doc       = rt.Doc
+		req, resp = routeTypes(rt)
+		params    = []interface{}{}
+		seen      = map[string]bool{}
+	)
+
+	if doc == nil {
+		doc = &RouteDoc{}
+	}
+
+	if doc.Summary != "" {
+		op["summary"] = doc.Summary
+	}
+	if doc.Description != "" {
+		op["description"] = doc.Description
+	}
+	if doc.OperationID != "" {
+		op["operationId"] = doc.OperationID
+	}
+	if len(doc.Tags) > 0 {
+		op["tags"] = doc.Tags
+	}
+	if doc.Deprecated {
+		op["deprecated"] = true
+	}
+
+	if req != nil {
+		for req.Kind() == reflect.Ptr {
+			req = req.Elem()
+		}
+
+		var (
+			body = map[string]interface{}{}
+			form = map[string]interface{}{}
+		)
+
+		if req.Kind() == reflect.Struct {
+			g.requestFields(req, doc, &params, seen, body, form)
+		} else {
+			body["schema"] = g.schema(req)
+		}
+
+		content := map[string]interface{}{}
+		if s, ok := body["schema"]; ok {
+			content["application/json"] = map[string]interface{}{"schema": s}
+		}
+		if s, ok := form["schema"]; ok {
+			content["application/x-www-form-urlencoded"] = map[string]interface{}{"schema": s}
+		}
+		if len(content) > 0 {
+			op["requestBody"] = map[string]interface{}{"content": content}
+		}
+	}
+
+	// path params are always documented, even without a request type
+	for _, m := range pathParamRe.FindAllStringSubmatch(rt.Path, -1) {
+		if seen["path:"+m[1]] {
+			continue
+		}
+
+		params = append(params, parameter(m[1], "path", doc, true, map[string]interface{}{"type": "string"}))
+	}
+
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	ok := map[string]interface{}{"description": http.StatusText(http.StatusOK)}
+	if resp != nil {
+		ok["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": g.schema(resp)},
+		}
+	}
+
+	op["responses"] = map[string]interface{}{
+		"200": ok,
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": ref("Error")},
+			},
+		},
+	}
+
+	return op
+}
+
+func parameter(name, in string, doc *RouteDoc, required bool, schema interface{}) map[string]interface{} {
+	p := map[string]interface{}{
+		"name":   name,
+		"in":     in,
+		"schema": schema,
+	}
+
+	if required {
+		p["required"] = true
+	}
+	if desc := doc.Params[name]; desc != "" {
+		p["description"] = desc
+	}
+
+	return p
+}
+
+// requestFields splits the fields of the request struct t into
+// parameters and json and form body schemas
+func (g *schemaGen) requestFields(t reflect.Type, doc *RouteDoc, params *[]interface{}, seen map[string]bool, body, form map[string]interface{}) {
+	var (
+		bodyProps = map[string]interface{}{}
+		bodyReq   []string
+		formProps = map[string]interface{}{}
+		formReq   []string
+	)
+
+	eachField(t, func(f reflect.StructField) {
+		var (
+			source, key = fieldName(f)
+			rules       = f.Tag.Get("validate")
+			schema      = g.fieldSchema(f)
+			required    = hasRule(rules, "required")
+		)
+
+		switch source {
+		case "path", "query", "header", "cookie":
+			seen[source+":"+key] = true
+			*params = append(*params, parameter(key, source, doc, required || source == "path", schema))
+		case "form":
+			formProps[key] = schema
+			if required {
+				formReq = append(formReq, key)
+			}
+		default:
+			if tag := f.Tag.Get("json"); tag == "-" {
+				return
+			}
+			bodyProps[key] = schema
+			if required {
+				bodyReq = append(bodyReq, key)
+			}
+		}
+	})
+
+	if len(bodyProps) > 0 {
+		body["schema"] = objectSchema(bodyProps, bodyReq)
+	}
+	if len(formProps) > 0 {
+		form["schema"] = objectSchema(formProps, formReq)
+	}
+}
+
+// eachField calls fn for each exported field of t, flattening
+// embedded structs like encoding/json
+func eachField(t reflect.Type, fn func(reflect.StructField)) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && f.Tag.Get("json") == "" {
+				eachField(ft, fn)
+				continue
+			}
+		}
+
+		if f.PkgPath != "" {
+			continue
+		}
+
+		fn(f)
+	}
+}
+
+func objectSchema(props map[string]interface{}, required []string) map[string]interface{} {
+	s := map[string]interface{}{
+		"type":       "object",
+		"properties": props,
+	}
+
+	if len(required) > 0 {
+		s["required"] = required
+	}
+
+	return s
+}
+
+func ref(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+var schemaNameRe = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// typeArgsRe matches the package of a type argument in the name of a
+// generic instantiation, e.g. "github.com/x/y." in Page[github.com/x/y.User]
+var typeArgsRe = regexp.MustCompile(`[^\[\],*]*\.`)
+
+// schemaName returns the component name of t. Types in different
+// packages with the same name are prefixed with their package name and
+// numbered if they still collide.
+func (g *schemaGen) schemaName(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+
+	base := typeArgsRe.ReplaceAllString(t.Name(), "")
+	base = cleanSchemaName(strings.ReplaceAll(base, "*", "Ptr"))
+	if base == "" {
+		return ""
+	}
+
+	name := base
+	if _, ok := g.types[name]; ok {
+		name = cleanSchemaName(path.Base(t.PkgPath())) + "_" + base
+	}
+	for i := 2; ; i++ {
+		if _, ok := g.types[name]; !ok {
+			break
+		}
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+
+	g.names[t], g.types[name] = name, t
+	return name
+}
+
+func cleanSchemaName(name string) string {
+	return strings.Trim(schemaNameRe.ReplaceAllString(name, "_"), "_")
+}
+
+// fieldSchema returns the schema for f with constraints from
+// its validate tag applied
+func (g *schemaGen) fieldSchema(f reflect.StructField) interface{} {
+	schema := g.schema(f.Type)
+
+	rules := f.Tag.Get("validate")
+	if rules == "" {
+		return schema
+	}
+
+	// named types are referenced, so constraints can't be added to them
+	s, ok := schema.(map[string]interface{})
+	if !ok || s["$ref"] != nil {
+		return schema
+	}
+
+	cp := map[string]interface{}{}
+	for k, v := range s {
+		cp[k] = v
+	}
+
+	var (
+		typ         = cp["type"]
+		minK, maxK  = "minimum", "maximum"
+		isLengthTyp = true
+	)
+
+	switch typ {
+	case "string":
+		minK, maxK = "minLength", "maxLength"
+	case "array":
+		minK, maxK = "minItems", "maxItems"
+	case "object":
+		minK, maxK = "minProperties", "maxProperties"
+	default:
+		isLengthTyp = false
+	}
+
+	for _, part := range strings.Split(rules, ",") {
+		var (
+			kv    = strings.SplitN(strings.TrimSpace(part), "=", 2)
+			param string
+		)
+		if len(kv) == 2 {
+			param = kv[1]
+		}
+
+		switch kv[0] {
+		case "min", "max", "len":
+			n, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				continue
+			}
+			if kv[0] != "max" {
+				cp[minK] = n
+			}
+			if kv[0] != "min" {
+				cp[maxK] = n
+			}
+		case "oneof":
+			var enum []interface{}
+			for _, o := range strings.Fields(param) {
+				if n, err := strconv.ParseFloat(o, 64); err == nil && !isLengthTyp {
+					enum = append(enum, n)
+				} else {
+					enum = append(enum, o)
+				}
+			}
+			cp["enum"] = enum
+		}
+	}
+
+	return cp
+}
+
+func hasRule(rules, name string) bool {
+	for _, part := range strings.Split(rules, ",") {
+		part = strings.TrimSpace(part)
+		if part == name || strings.HasPrefix(part, name+"=") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// schema returns the json schema for values of t. Named structs are
+// added to the components and referenced.
+func (g *schemaGen) schema(t reflect.Type) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case uuidType:
+		return map[string]interface{}{"type": "string", "format": "uuid"}
+	case durationType:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	}
+
+	switch {
+	case t.Implements(jsonMarshalerType), reflect.PtrTo(t).Implements(jsonMarshalerType):
+		return map[string]interface{}{}
+	case t.Implements(textMarshalerType), reflect.PtrTo(t).Implements(textMarshalerType):
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32:
+		return map[string]interface{}{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		name := g.schemaName(t)
+		if name == "" {
+			return g.structSchema(t)
+		}
+
+		if _, ok := g.components[name]; !ok {
+			// placeholder to stop recursive types from looping
+			g.components[name] = map[string]interface{}{}
+			g.components[name] = g.structSchema(t)
+		}
+		return ref(name)
+	}
+
+	return map[string]interface{}{}
+}
+
+func (g *schemaGen) structSchema(t reflect.Type) map[string]interface{} {
+	var (
+		props    = map[string]interface{}{}
+		required []string
+	)
+
+	eachField(t, func(f reflect.StructField) {
+		if f.Tag.Get("json") == "-" {
+			return
+		}
+
+		_, key := fieldName(f)
+		props[key] = g.fieldSchema(f)
+		if hasRule(f.Tag.Get("validate"), "required") {
+			required = append(required, key)
+		}
+	})
+
+	return objectSchema(props, required)
+}
+
+// MarshalYAML encodes v as YAML. v is converted via encoding/json,
+// so json struct tags are honored and keys keep their json order.
+func MarshalYAML(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	n, err := jsonYAMLNode(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(n); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// jsonYAMLNode reads the next json value from dec as a yaml node
+func jsonYAMLNode(dec *json.Decoder) (*yaml.Node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok := tok.(type) {
+	case json.Delim:
+		n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		if tok == '{' {
+			n.Kind, n.Tag = yaml.MappingNode, "!!map"
+		}
+
+		for dec.More() {
+			if n.Kind == yaml.MappingNode {
+				k, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k.(string)})
+			}
+
+			c, err := jsonYAMLNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, c)
+		}
+
+		// the closing delimiter
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+
+		if len(n.Content) == 0 {
+			n.Style = yaml.FlowStyle
+		}
+		return n, nil
+	case nil:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(tok)}, nil
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(tok.String(), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: tok.String()}, nil
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: tok}, nil
+	}
+
+	return nil, fmt.Errorf("unexpected json token %v", tok)
+}
@@ -0,0 +1,91 @@
+//go:build dev
+// +build dev
+
+package httpsrv
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/jonasi/ctxlog"
+)
+
+// validateResponse buffers json responses and logs any violations of
+// the schema documented for their status
+func (s *OpenAPISpec) validateResponse(op map[string]interface{}, h http.Handler) http.Handler {
+	if !s.ValidateResponses {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+
+		if err := s.checkResponse(op, rec); err != nil {
+			ctxlog.Errorf(r.Context(), "Response for %s %s does not match openapi spec: %s", r.Method, r.URL.Path, err)
+		}
+
+		w.WriteHeader(rec.status)
+		_, _ = rec.body.WriteTo(w)
+	})
+}
+
+func (s *OpenAPISpec) checkResponse(op map[string]interface{}, rec *responseRecorder) error {
+	resps, _ := op["responses"].(map[string]interface{})
+
+	resp := s.resolve(resps[strconv.Itoa(rec.status)])
+	if resp == nil {
+		resp = s.resolve(resps[strconv.Itoa(rec.status/100)+"XX"])
+	}
+	if resp == nil {
+		resp = s.resolve(resps["default"])
+	}
+	if resp == nil {
+		return ParamErrors{{Source: "response", Key: "status", Value: strconv.Itoa(rec.status), Err: errUndocumentedStatus}}
+	}
+
+	ct, _, _ := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+	content, _ := resp["content"].(map[string]interface{})
+	media := s.mediaType(content, ct)
+	if media == nil || rec.body.Len() == 0 {
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(rec.body.Bytes()))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil
+	}
+
+	var errs ParamErrors
+	for _, err := range s.validate(s.resolve(media["schema"]), v, "") {
+		errs = append(errs, err.(*ParamError))
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// responseRecorder buffers a response so it can be inspected
+// before being written
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
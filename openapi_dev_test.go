@@ -0,0 +1,59 @@
+//go:build dev
+// +build dev
+
+package httpsrv
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func checkTestResponse(t *testing.T, status int, ct, body string) error {
+	t.Helper()
+
+	var (
+		spec = parseTestSpec(t)
+		rec  = &responseRecorder{ResponseWriter: httptest.NewRecorder(), status: status}
+	)
+
+	rec.Header().Set("Content-Type", ct)
+	rec.body.WriteString(body)
+
+	return spec.checkResponse(spec.Operation("PUT", "/users/:id"), rec)
+}
+
+func TestCheckResponse(t *testing.T) {
+	if err := checkTestResponse(t, 200, "application/json", `{"name":"a"}`); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	err := checkTestResponse(t, 200, "application/json; charset=utf-8", `{"name":"","version":"1"}`)
+	if errs, ok := err.(ParamErrors); !ok || len(errs) != 2 || errs[0].Key != "name" || errs[1].Key != "version" {
+		t.Errorf("expected name and version errors, got %v", err)
+	}
+
+	err = checkTestResponse(t, 404, "application/json", `{}`)
+	if errs, ok := err.(ParamErrors); !ok || len(errs) != 1 || !errors.Is(errs[0].Err, errUndocumentedStatus) {
+		t.Errorf("expected an undocumented status error, got %v", err)
+	}
+}
+
+func TestValidateResponsePassthrough(t *testing.T) {
+	spec := parseTestSpec(t)
+	spec.ValidateResponses = true
+
+	h := spec.validateResponse(spec.Operation("PUT", "/users/:id"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"name":""}`))
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("PUT", "/users/1", nil))
+
+	if w.Code != http.StatusAccepted || w.Body.String() != `{"name":""}` {
+		t.Errorf("response not passed through: %d %q", w.Code, w.Body)
+	}
+}
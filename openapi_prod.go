@@ -0,0 +1,12 @@
+//go:build !dev
+// +build !dev
+
+package httpsrv
+
+import (
+	"net/http"
+)
+
+func (s *OpenAPISpec) validateResponse(op map[string]interface{}, h http.Handler) http.Handler {
+	return h
+}
@@ -0,0 +1,93 @@
+package httpsrv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type getUserReq struct {
+	ID    int     `path:"id"`
+	Limit int     `query:"limit" validate:"min=1,max=100"`
+	Score float64 `query:"score"`
+}
+
+func TestOpenAPIRouteYAML(t *testing.T) {
+	var (
+		s    = New(":0")
+		info = OpenAPIInfo{Title: "users", Version: "1.0", Description: "yes: no\n# not a comment\n'quoted' \"200\""}
+	)
+
+	s.Handle(&Route{
+		Method:  "GET",
+		Path:    "/users/:id",
+		Handler: http.NotFoundHandler(),
+		Doc:     &RouteDoc{Summary: "true", Tags: []string{"null", "1.5"}, Request: getUserReq{}},
+	})
+
+	var (
+		rt = OpenAPIRoute("/openapi.yaml", info)
+		r  = httptest.NewRequest("GET", "/openapi.yaml", nil)
+		w  = httptest.NewRecorder()
+	)
+	rt.Handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), serverKey{}, s)))
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/yaml" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+
+	spec, err := ParseOpenAPI(w.Body.Bytes())
+	if err != nil {
+		t.Fatalf("unable to parse generated yaml: %s\n%s", err, w.Body)
+	}
+
+	b, err := json.Marshal(s.OpenAPI(info))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var want map[string]interface{}
+	if err := dec.Decode(&want); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(spec.doc, want) {
+		t.Errorf("yaml round trip mismatch\n%s", w.Body)
+	}
+
+	if op := spec.Operation("GET", "/users/:id"); op == nil || op["summary"] != "true" {
+		t.Errorf("unexpected operation %v", op)
+	}
+}
+
+func TestMarshalYAMLKeyOrder(t *testing.T) {
+	v := struct {
+		B     string            `json:"b"`
+		A     []int             `json:"a"`
+		Empty map[string]string `json:"empty"`
+	}{B: "x", A: []int{1, 2}, Empty: map[string]string{}}
+
+	b, err := MarshalYAML(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.Join([]string{
+		"b: x",
+		"a:",
+		"  - 1",
+		"  - 2",
+		"empty: {}",
+		"",
+	}, "\n")
+	if string(b) != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, b)
+	}
+}
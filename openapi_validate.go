@@ -0,0 +1,737 @@
+package httpsrv
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+var errUndocumentedStatus = errors.New("undocumented status")
+
+// OpenAPISpec is a parsed OpenAPI 3 document used to validate requests
+type OpenAPISpec struct {
+	doc map[string]interface{}
+
+	// ValidateResponses validates json responses against the documented
+	// response schemas and logs violations. It only takes effect in dev
+	// builds.
+	ValidateResponses bool
+	// MaxBytes limits the size of request bodies buffered for
+	// validation. Larger bodies are rejected with a 413. Defaults to
+	// DefaultJSONDecoder.MaxBytes.
+	MaxBytes int64
+
+	mu       sync.Mutex
+	patterns map[string]*regexp.Regexp
+}
+
+// LoadOpenAPI reads the json or yaml OpenAPI document name from fs
+func LoadOpenAPI(fs http.FileSystem, name string) (*OpenAPISpec, error) {
+	b, err := ReadFile(fs, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseOpenAPI(b)
+}
+
+// ParseOpenAPI parses a json or yaml OpenAPI document. Documents that
+// do not start with { are parsed as yaml.
+func ParseOpenAPI(b []byte) (*OpenAPISpec, error) {
+	if t := bytes.TrimSpace(b); len(t) == 0 || t[0] != '{' {
+		var err error
+		if b, err = yamlToJSON(b); err != nil {
+			return nil, err
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var doc map[string]interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	if v, _ := doc["openapi"].(string); !strings.HasPrefix(v, "3.") {
+		return nil, fmt.Errorf("httpsrv: unsupported openapi version %q", v)
+	}
+
+	return &OpenAPISpec{doc: doc, patterns: map[string]*regexp.Regexp{}}, nil
+}
+
+// yamlToJSON converts a yaml document to json. Mapping keys are kept
+// as strings, so keys such as response codes are not made numbers.
+func yamlToJSON(b []byte) ([]byte, error) {
+	var n yaml.Node
+	if err := yaml.Unmarshal(b, &n); err != nil {
+		return nil, err
+	}
+
+	v, err := yamlValue(&n)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(v)
+}
+
+func yamlValue(n *yaml.Node) (interface{}, error) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil, nil
+		}
+		return yamlValue(n.Content[0])
+	case yaml.AliasNode:
+		return yamlValue(n.Alias)
+	case yaml.MappingNode:
+		m := make(map[string]interface{}, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			v, err := yamlValue(n.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			m[n.Content[i].Value] = v
+		}
+		return m, nil
+	case yaml.SequenceNode:
+		l := make([]interface{}, len(n.Content))
+		for i, c := range n.Content {
+			v, err := yamlValue(c)
+			if err != nil {
+				return nil, err
+			}
+			l[i] = v
+		}
+		return l, nil
+	}
+
+	var v interface{}
+	if err := n.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Operation returns the operation documented for the httprouter
+// style method and path, or nil
+func (s *OpenAPISpec) Operation(method, path string) map[string]interface{} {
+	paths, _ := s.doc["paths"].(map[string]interface{})
+	item, _ := paths[OpenAPIPath(path)].(map[string]interface{})
+	if item == nil {
+		return nil
+	}
+
+	op, _ := item[strings.ToLower(method)].(map[string]interface{})
+	if op == nil {
+		return nil
+	}
+
+	// merge in path level parameters not overridden by the operation
+	params := s.params(op["parameters"])
+	for _, p := range s.params(item["parameters"]) {
+		dup := false
+		for _, op := range params {
+			if op["name"] == p["name"] && op["in"] == p["in"] {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			params = append(params, p)
+		}
+	}
+
+	merged := map[string]interface{}{}
+	for k, v := range op {
+		merged[k] = v
+	}
+	merged["parameters"] = params
+
+	return merged
+}
+
+func (s *OpenAPISpec) params(v interface{}) []map[string]interface{} {
+	var out []map[string]interface{}
+	list, _ := v.([]interface{})
+	for _, p := range list {
+		if m := s.resolve(p); m != nil {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// resolve follows local $refs
+func (s *OpenAPISpec) resolve(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	for i := 0; m != nil && i < 32; i++ {
+		ref, ok := m["$ref"].(string)
+		if !ok || !strings.HasPrefix(ref, "#/") {
+			return m
+		}
+
+		var cur interface{} = s.doc
+		for _, part := range strings.Split(ref[2:], "/") {
+			part = strings.NewReplacer("~1", "/", "~0", "~").Replace(part)
+			obj, _ := cur.(map[string]interface{})
+			cur = obj[part]
+		}
+		m, _ = cur.(map[string]interface{})
+	}
+
+	return m
+}
+
+// Middleware returns a Middleware that validates requests against the
+// operation documented for each route. Routes that are not documented
+// are left untouched. Violations are written as a 400 with WriteError.
+func (s *OpenAPISpec) Middleware() Middleware {
+	return MiddlewareFunc("openapi_validator", func(method, path string, h http.Handler) http.Handler {
+		op := s.Operation(method, path)
+		if op == nil {
+			return h
+		}
+
+		h = s.validateResponse(op, h)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := s.ValidateRequest(op, r); err != nil {
+				WriteError(w, r, err)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	})
+}
+
+// ValidateRequest checks r against op. The body of r is buffered and
+// restored so it can be read again by the handler.
+func (s *OpenAPISpec) ValidateRequest(op map[string]interface{}, r *http.Request) error {
+	var errs ParamErrors
+
+	ps, _ := op["parameters"].([]map[string]interface{})
+	for _, p := range ps {
+		var (
+			name, _     = p["name"].(string)
+			in, _       = p["in"].(string)
+			required, _ = p["required"].(bool)
+			schema      = s.resolve(p["schema"])
+			rv          ReqValues
+		)
+
+		switch in {
+		case "path":
+			rv = ParamValues(r, name)
+		case "query":
+			rv = QueryValues(r, name)
+		case "header":
+			rv = HeaderValues(r, name)
+		case "cookie":
+			rv = CookieValues(r, name)
+		default:
+			continue
+		}
+
+		if !rv.Exists() {
+			if required || in == "path" {
+				errs = append(errs, rv.err(ErrMissingValue))
+			}
+			continue
+		}
+
+		if err := s.validateParam(schema, rv); err != nil {
+			errs = append(errs, &ParamError{Source: in, Key: name, Value: rv.String(), Err: err})
+		}
+	}
+
+	if err := s.validateBody(op, r); err != nil {
+		switch err := err.(type) {
+		case ParamErrors:
+			errs = append(errs, err...)
+		case *ParamError:
+			errs = append(errs, err)
+		default:
+			return err
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// validateParam converts the string values of rv to the type
+// described by schema and validates them
+func (s *OpenAPISpec) validateParam(schema map[string]interface{}, rv ReqValues) error {
+	if schema == nil {
+		return nil
+	}
+
+	if schemaType(schema) == "array" {
+		items := s.resolve(schema["items"])
+		var vals []interface{}
+		for _, str := range rv.Strings() {
+			v, err := paramValue(items, str)
+			if err != nil {
+				return err
+			}
+			vals = append(vals, v)
+		}
+		return firstErr(s.validate(schema, vals, ""))
+	}
+
+	v, err := paramValue(schema, rv.String())
+	if err != nil {
+		return err
+	}
+
+	return firstErr(s.validate(schema, v, ""))
+}
+
+// firstErr returns the underlying error of the first violation
+func firstErr(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	if perr, ok := errs[0].(*ParamError); ok {
+		return perr.Err
+	}
+	return errs[0]
+}
+
+func scalarString(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}, nil:
+		return ""
+	}
+
+	return fmt.Sprint(v)
+}
+
+func paramValue(schema map[string]interface{}, str string) (interface{}, error) {
+	switch schemaType(schema) {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(str, 64); err != nil {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return json.Number(str), nil
+	case "boolean":
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return nil, fmt.Errorf("must be a boolean")
+		}
+		return b, nil
+	}
+
+	return str, nil
+}
+
+func (s *OpenAPISpec) validateBody(op map[string]interface{}, r *http.Request) error {
+	rb := s.resolve(op["requestBody"])
+	if rb == nil {
+		return nil
+	}
+
+	required, _ := rb["required"].(bool)
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		if required {
+			return ParamErrors{{Source: "body", Err: errEmptyBody}}
+		}
+		return nil
+	}
+
+	content, _ := rb["content"].(map[string]interface{})
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	media := s.mediaType(content, ct)
+	if media == nil {
+		return NewStatusError(http.StatusUnsupportedMediaType, fmt.Errorf("unsupported content type %q", ct))
+	}
+
+	// only json bodies are validated against their schema
+	schema := s.resolve(media["schema"])
+	if schema == nil || !strings.HasSuffix(ct, "json") {
+		return nil
+	}
+
+	max := s.MaxBytes
+	if max == 0 {
+		max = DefaultJSONDecoder.MaxBytes
+	}
+
+	var body io.Reader = r.Body
+	if max > 0 {
+		body = &maxBytesReader{r: r.Body, n: max}
+	}
+
+	b, err := ioutil.ReadAll(body)
+	if err == errBodyTooLarge {
+		return jsonError(err)
+	} else if err != nil {
+		return err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return jsonError(err)
+	}
+
+	var errs ParamErrors
+	for _, err := range s.validate(schema, v, "") {
+		errs = append(errs, err.(*ParamError))
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// mediaType returns the media type object in content for the
+// content type ct, falling back to type/* and then */*. Media type
+// parameters are ignored.
+func (s *OpenAPISpec) mediaType(content map[string]interface{}, ct string) map[string]interface{} {
+	types := make(map[string]interface{}, len(content))
+	for k, v := range content {
+		mt, _, err := mime.ParseMediaType(k)
+		if err != nil {
+			mt = strings.ToLower(k)
+		}
+		types[mt] = v
+	}
+
+	candidates := []string{ct}
+	if i := strings.Index(ct, "/"); i != -1 {
+		candidates = append(candidates, ct[:i]+"/*")
+	}
+	candidates = append(candidates, "*/*")
+
+	for _, c := range candidates {
+		if media := s.resolve(types[c]); media != nil {
+			return media
+		}
+	}
+
+	return nil
+}
+
+func schemaType(schema map[string]interface{}) string {
+	switch t := schema["type"].(type) {
+	case string:
+		return t
+	case []interface{}:
+		// 3.1 style type lists, e.g. ["string", "null"]
+		for _, v := range t {
+			if s, _ := v.(string); s != "null" {
+				return s
+			}
+		}
+	}
+
+	return ""
+}
+
+func schemaTypes(schema map[string]interface{}) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		if n, _ := schema["nullable"].(bool); n {
+			return []string{t, "null"}
+		}
+		return []string{t}
+	case []interface{}:
+		var out []string
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+
+	return nil
+}
+
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+
+	return ""
+}
+
+func numberVal(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	}
+
+	return 0, false
+}
+
+// jsonEqual reports whether the decoded json values a and b are equal.
+// Numbers are compared by value, so 1 and 1.0 are equal.
+func jsonEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+
+		x, okx := new(big.Rat).SetString(a.String())
+		y, oky := new(big.Rat).SetString(b.String())
+		return okx && oky && x.Cmp(y) == 0
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+
+		for i := range a {
+			if !jsonEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+
+		for k, v := range a {
+			if bv, ok := b[k]; !ok || !jsonEqual(v, bv) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return a == b
+}
+
+func (s *OpenAPISpec) pattern(p string) (*regexp.Regexp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if re, ok := s.patterns[p]; ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	s.patterns[p] = re
+	return re, nil
+}
+
+// validate checks v against schema, returning a *ParamError for each
+// violation keyed by the json path of the offending value
+func (s *OpenAPISpec) validate(schema map[string]interface{}, v interface{}, path string) []error {
+	schema = s.resolve(schema)
+	if schema == nil {
+		return nil
+	}
+
+	fail := func(format string, args ...interface{}) []error {
+		return []error{&ParamError{Source: "body", Key: path, Value: scalarString(v), Err: fmt.Errorf(format, args...)}}
+	}
+
+	for _, sub := range listOf(schema["allOf"]) {
+		if errs := s.validate(s.resolve(sub), v, path); len(errs) > 0 {
+			return errs
+		}
+	}
+
+	if subs := listOf(schema["anyOf"]); len(subs) > 0 {
+		ok := false
+		for _, sub := range subs {
+			if len(s.validate(s.resolve(sub), v, path)) == 0 {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fail("must match at least one schema")
+		}
+	}
+
+	if subs := listOf(schema["oneOf"]); len(subs) > 0 {
+		n := 0
+		for _, sub := range subs {
+			if len(s.validate(s.resolve(sub), v, path)) == 0 {
+				n++
+			}
+		}
+		if n != 1 {
+			return fail("must match exactly one schema")
+		}
+	}
+
+	typ := jsonType(v)
+	if types := schemaTypes(schema); len(types) > 0 {
+		ok := false
+		for _, t := range types {
+			if t == typ || (t == "number" && typ == "integer") {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fail("must be of type %s", strings.Join(types, " or "))
+		}
+	}
+
+	if enum := listOf(schema["enum"]); len(enum) > 0 {
+		ok := false
+		for _, e := range enum {
+			if jsonEqual(e, v) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fail("must be one of %v", enum)
+		}
+	}
+
+	switch v := v.(type) {
+	case json.Number:
+		n, _ := numberVal(v)
+		if min, ok := numberVal(schema["minimum"]); ok && n < min {
+			return fail("must be at least %v", schema["minimum"])
+		}
+		if max, ok := numberVal(schema["maximum"]); ok && n > max {
+			return fail("must be at most %v", schema["maximum"])
+		}
+	case string:
+		l := float64(len([]rune(v)))
+		if min, ok := numberVal(schema["minLength"]); ok && l < min {
+			return fail("must have a length of at least %v", schema["minLength"])
+		}
+		if max, ok := numberVal(schema["maxLength"]); ok && l > max {
+			return fail("must have a length of at most %v", schema["maxLength"])
+		}
+		if p, ok := schema["pattern"].(string); ok {
+			re, err := s.pattern(p)
+			if err != nil {
+				return fail("invalid pattern %q", p)
+			}
+			if !re.MatchString(v) {
+				return fail("must match pattern %q", p)
+			}
+		}
+	case []interface{}:
+		l := float64(len(v))
+		if min, ok := numberVal(schema["minItems"]); ok && l < min {
+			return fail("must have at least %v items", schema["minItems"])
+		}
+		if max, ok := numberVal(schema["maxItems"]); ok && l > max {
+			return fail("must have at most %v items", schema["maxItems"])
+		}
+
+		var errs []error
+		items := s.resolve(schema["items"])
+		for i, e := range v {
+			errs = append(errs, s.validate(items, e, joinPath(path, strconv.Itoa(i)))...)
+		}
+		return errs
+	case map[string]interface{}:
+		var (
+			errs  []error
+			props = s.resolveMap(schema["properties"])
+		)
+
+		for _, req := range listOf(schema["required"]) {
+			k, _ := req.(string)
+			if _, ok := v[k]; !ok {
+				errs = append(errs, &ParamError{Source: "body", Key: joinPath(path, k), Err: ErrMissingValue})
+			}
+		}
+
+		for _, k := range sortedKeys(v) {
+			if ps, ok := props[k]; ok {
+				errs = append(errs, s.validate(ps, v[k], joinPath(path, k))...)
+				continue
+			}
+
+			switch ap := schema["additionalProperties"].(type) {
+			case bool:
+				if !ap {
+					errs = append(errs, &ParamError{Source: "body", Key: joinPath(path, k), Err: fmt.Errorf("unknown field")})
+				}
+			case map[string]interface{}:
+				errs = append(errs, s.validate(s.resolve(ap), v[k], joinPath(path, k))...)
+			}
+		}
+		return errs
+	}
+
+	return nil
+}
+
+func (s *OpenAPISpec) resolveMap(v interface{}) map[string]map[string]interface{} {
+	out := map[string]map[string]interface{}{}
+	m, _ := v.(map[string]interface{})
+	for k, sub := range m {
+		out[k] = s.resolve(sub)
+	}
+	return out
+}
+
+func listOf(v interface{}) []interface{} {
+	l, _ := v.([]interface{})
+	return l
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
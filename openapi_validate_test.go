@@ -0,0 +1,196 @@
+package httpsrv
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const testSpec = `
+openapi: 3.1.0
+paths:
+  /users/{id}:
+    parameters:
+      - name: id
+        in: path
+        schema:
+          type: integer
+    put:
+      parameters:
+        - name: limit
+          in: query
+          required: true
+          schema:
+            type: integer
+            minimum: 1
+            maximum: 100
+        - name: level
+          in: query
+          schema:
+            type: integer
+            enum: [1, 2]
+        - name: sort
+          in: query
+          schema:
+            type: string
+            enum: [asc, desc]
+      requestBody:
+        required: true
+        content:
+          application/*:
+            schema:
+              $ref: '#/components/schemas/User'
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json; charset=utf-8:
+              schema:
+                $ref: '#/components/schemas/User'
+components:
+  schemas:
+    User:
+      type: object
+      required: [name]
+      additionalProperties: false
+      properties:
+        name:
+          type: string
+          minLength: 1
+        version:
+          enum: [1.0, "2"]
+`
+
+func parseTestSpec(t *testing.T) *OpenAPISpec {
+	t.Helper()
+
+	spec, err := ParseOpenAPI([]byte(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+// validateTestRequest validates a PUT /users/:id request with the id
+// param, query, content type and body against the test spec
+func validateTestRequest(t *testing.T, id, query, ct, body string) error {
+	t.Helper()
+
+	var (
+		spec = parseTestSpec(t)
+		r    = httptest.NewRequest("PUT", "/users/"+id+"?"+query, strings.NewReader(body))
+	)
+
+	r.Header.Set("Content-Type", ct)
+	r = r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, httprouter.Params{{Key: "id", Value: id}}))
+
+	return spec.ValidateRequest(spec.Operation("PUT", "/users/:id"), r)
+}
+
+func TestValidateRequestValid(t *testing.T) {
+	for _, ct := range []string{"application/json", "application/json; charset=utf-8", "application/merge-patch+json"} {
+		if err := validateTestRequest(t, "1", "limit=5&level=2&sort=asc", ct, `{"name":"a","version":1}`); err != nil {
+			t.Errorf("%s: unexpected error %v", ct, err)
+		}
+	}
+}
+
+func TestValidateRequestParams(t *testing.T) {
+	for _, tt := range []struct {
+		id, query string
+		source    string
+		key       string
+	}{
+		{"abc", "limit=5", "path", "id"},
+		{"1", "", "query", "limit"},
+		{"1", "limit=0", "query", "limit"},
+		{"1", "limit=x", "query", "limit"},
+		{"1", "limit=5&level=3", "query", "level"},
+		{"1", "limit=5&sort=up", "query", "sort"},
+	} {
+		err := validateTestRequest(t, tt.id, tt.query, "application/json", `{"name":"a"}`)
+
+		errs, ok := err.(ParamErrors)
+		if !ok || len(errs) != 1 || errs[0].Source != tt.source || errs[0].Key != tt.key {
+			t.Errorf("%s?%s: expected a %s error for %s, got %v", tt.id, tt.query, tt.source, tt.key, err)
+		}
+	}
+}
+
+func TestValidateRequestBody(t *testing.T) {
+	for body, keys := range map[string][]string{
+		`{}`:                           {"name"},
+		`{"name":""}`:                  {"name"},
+		`{"name":"a","extra":1}`:       {"extra"},
+		`{"name":"a","version":"1"}`:   {"version"},
+		`{"name":"a","version":2}`:     {"version"},
+		`{"name":1,"version":"true"}`:  {"name", "version"},
+		`{"name":"a","version":"2"}`:   nil,
+		`{"name":"a","version":1e0}`:   nil,
+		`{"name":"a","version":1.000}`: nil,
+	} {
+		err := validateTestRequest(t, "1", "limit=5", "application/json", body)
+		if keys == nil {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", body, err)
+			}
+			continue
+		}
+
+		errs, _ := err.(ParamErrors)
+		if len(errs) != len(keys) {
+			t.Errorf("%s: expected errors for %v, got %v", body, keys, err)
+			continue
+		}
+		for i, k := range keys {
+			if errs[i].Source != "body" || errs[i].Key != k {
+				t.Errorf("%s: expected a body error for %s, got %v", body, k, errs[i])
+			}
+		}
+	}
+}
+
+func TestValidateRequestContentType(t *testing.T) {
+	err := validateTestRequest(t, "1", "limit=5", "text/plain", "hi")
+
+	var serr *StatusError
+	if !errors.As(err, &serr) || serr.Status != http.StatusUnsupportedMediaType {
+		t.Errorf("expected a 415, got %v", err)
+	}
+}
+
+func TestOpenAPISpecMiddleware(t *testing.T) {
+	var (
+		spec   = parseTestSpec(t)
+		router = httprouter.New()
+		called bool
+	)
+
+	router.Handler("PUT", "/users/:id", spec.Middleware().Handler("PUT", "/users/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})))
+
+	for _, tt := range []struct {
+		target string
+		status int
+	}{
+		{"/users/1?limit=5", http.StatusOK},
+		{"/users/x?limit=5", http.StatusBadRequest},
+	} {
+		called = false
+
+		r := httptest.NewRequest("PUT", tt.target, strings.NewReader(`{"name":"a"}`))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		if w.Code != tt.status || called != (tt.status == http.StatusOK) {
+			t.Errorf("%s: expected %d, got %d (handler called: %v)", tt.target, tt.status, w.Code, called)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package httpsrv
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WhiteoutPrefix marks a file in a layer that hides the file with the
+// rest of its name in lower layers, e.g. .wh.logo.png hides logo.png
+const WhiteoutPrefix = ".wh."
+
+// WhiteoutOpaque marks a directory in a layer whose contents hide the
+// contents of the same directory in lower layers
+const WhiteoutOpaque = WhiteoutPrefix + WhiteoutPrefix + ".opq"
+
+// NewOverlay returns an initialized *Overlay of layers, where later
+// layers take precedence over earlier ones
+func NewOverlay(layers ...http.FileSystem) *Overlay {
+	return &Overlay{
+		layers:    layers,
+		whiteouts: map[string]bool{},
+		dirs:      map[layerDirKey]*layerDir{},
+	}
+}
+
+// Overlay is an http.FileSystem that stacks layers, e.g. embedded
+// defaults, a theme directory and a customer override directory. Files
+// in higher layers shadow files in lower layers, including everything
+// under a file's name, and directory listings are merged across layers.
+// A layer hides a name in lower layers with a whiteout of the name or
+// one of its parents, or with an opaque parent directory.
+//
+// Directory listings of each layer are cached to resolve names. In dev
+// builds they are reloaded when a directory changes on disk, otherwise
+// Invalidate must be called after changing a layer.
+type Overlay struct {
+	mu        sync.RWMutex
+	layers    []http.FileSystem
+	whiteouts map[string]bool
+
+	dirsMu sync.Mutex
+	dirs   map[layerDirKey]*layerDir
+}
+
+// AddLayer adds fs above the existing layers
+func (o *Overlay) AddLayer(fs http.FileSystem) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.layers = append(o.layers, fs)
+}
+
+// AddLayerFS adds fsys, e.g. an embed.FS, above the existing layers
+func (o *Overlay) AddLayerFS(fsys fs.FS) {
+	o.AddLayer(http.FS(fsys))
+}
+
+// Remove hides name, and everything under it if it is a directory, in
+// every layer
+func (o *Overlay) Remove(name string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.whiteouts[path.Clean("/"+name)] = true
+}
+
+// Restore undoes Remove
+func (o *Overlay) Restore(name string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.whiteouts, path.Clean("/"+name))
+}
+
+// Invalidate drops the cached directory listings of every layer
+func (o *Overlay) Invalidate() {
+	o.dirsMu.Lock()
+	defer o.dirsMu.Unlock()
+	o.dirs = map[layerDirKey]*layerDir{}
+}
+
+// removed reports whether name or one of its parents was removed.
+// o.mu must be held.
+func (o *Overlay) removed(name string) bool {
+	for {
+		if o.whiteouts[name] {
+			return true
+		}
+		if name == "/" {
+			return false
+		}
+		name = path.Dir(name)
+	}
+}
+
+// Open satisfies http.FileSystem
+func (o *Overlay) Open(name string) (http.File, error) {
+	name = path.Clean("/" + name)
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	if o.removed(name) || strings.HasPrefix(path.Base(name), WhiteoutPrefix) {
+		return nil, os.ErrNotExist
+	}
+
+	var dirs []http.File
+
+	for i := len(o.layers) - 1; i >= 0; i-- {
+		found, hides := o.resolve(i, name)
+		if !found {
+			if hides {
+				break
+			}
+			continue
+		}
+
+		if f, err := o.layers[i].Open(name); err == nil {
+			fi, err := f.Stat()
+			switch {
+			case err != nil:
+				f.Close()
+			case !fi.IsDir():
+				// a file shadows directories in lower layers
+				if len(dirs) > 0 {
+					f.Close()
+					return &overlayDir{File: dirs[0], dirs: dirs, hidden: o.hiddenIn(name)}, nil
+				}
+				return f, nil
+			default:
+				dirs = append(dirs, f)
+			}
+		}
+
+		if hides {
+			break
+		}
+	}
+
+	if len(dirs) == 0 {
+		return nil, os.ErrNotExist
+	}
+
+	return &overlayDir{File: dirs[0], dirs: dirs, hidden: o.hiddenIn(name)}, nil
+}
+
+// hiddenIn returns the names removed directly under dir. o.mu must be
+// held.
+func (o *Overlay) hiddenIn(dir string) map[string]bool {
+	hidden := map[string]bool{}
+	for n := range o.whiteouts {
+		if path.Dir(n) == dir {
+			hidden[path.Base(n)] = true
+		}
+	}
+	return hidden
+}
+
+// resolve reports whether layer i has name and whether it hides name
+// in the layers below it. The layer is walked down from the root using
+// cached listings, stopping at the first parent it does not have.
+// o.mu must be held.
+func (o *Overlay) resolve(i int, name string) (found, hides bool) {
+	if name == "/" {
+		ld := o.layerDir(i, name)
+		return ld != nil, ld != nil && ld.opaque
+	}
+
+	var (
+		dir   = "/"
+		parts = strings.Split(name[1:], "/")
+	)
+
+	for n, part := range parts {
+		ld := o.layerDir(i, dir)
+		if ld == nil {
+			return false, hides
+		}
+
+		// a whiteout hides lower layers but not the rest of this one
+		hides = hides || ld.opaque || ld.whiteouts[part]
+
+		isDir, ok := ld.children[part]
+		switch {
+		case !ok:
+			return false, hides
+		case n == len(parts)-1:
+			if isDir {
+				sub := o.layerDir(i, name)
+				hides = hides || (sub != nil && sub.opaque)
+			}
+			return true, hides
+		case !isDir:
+			// a file shadows everything under its name
+			return false, true
+		}
+
+		dir = path.Join(dir, part)
+	}
+
+	return false, hides
+}
+
+type layerDirKey struct {
+	layer int
+	dir   string
+}
+
+// layerDir is the listing of a directory in a single layer
+type layerDir struct {
+	modTime   time.Time
+	opaque    bool
+	whiteouts map[string]bool
+	// children maps entry names to whether they are directories
+	children map[string]bool
+}
+
+// layerDir returns the cached listing of dir in layer i, or nil if dir
+// is not a directory in the layer. o.mu must be held.
+func (o *Overlay) layerDir(i int, dir string) *layerDir {
+	key := layerDirKey{layer: i, dir: dir}
+
+	o.dirsMu.Lock()
+	ld, ok := o.dirs[key]
+	o.dirsMu.Unlock()
+
+	if ok && !staleLayerDir(o.layers[i], dir, ld) {
+		return ld
+	}
+
+	ld = readLayerDir(o.layers[i], dir)
+
+	o.dirsMu.Lock()
+	defer o.dirsMu.Unlock()
+	if ld == nil {
+		delete(o.dirs, key)
+	} else {
+		o.dirs[key] = ld
+	}
+	return ld
+}
+
+func readLayerDir(fs http.FileSystem, dir string) *layerDir {
+	f, err := fs.Open(dir)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil || !fi.IsDir() {
+		return nil
+	}
+
+	fis, err := f.Readdir(-1)
+	if err != nil {
+		return nil
+	}
+
+	ld := &layerDir{
+		modTime:   fi.ModTime(),
+		whiteouts: map[string]bool{},
+		children:  make(map[string]bool, len(fis)),
+	}
+
+	for _, fi := range fis {
+		switch name := fi.Name(); {
+		case name == WhiteoutOpaque:
+			ld.opaque = true
+		case strings.HasPrefix(name, WhiteoutPrefix):
+			ld.whiteouts[strings.TrimPrefix(name, WhiteoutPrefix)] = true
+		default:
+			ld.children[name] = fi.IsDir()
+		}
+	}
+
+	return ld
+}
+
+// overlayDir is a directory merged across layers, ordered from the
+// highest layer down
+type overlayDir struct {
+	http.File
+	dirs   []http.File
+	hidden map[string]bool
+
+	entries []os.FileInfo
+	read    bool
+	pos     int
+}
+
+func (d *overlayDir) Close() error {
+	var err error
+	for _, f := range d.dirs {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (d *overlayDir) Readdir(count int) ([]os.FileInfo, error) {
+	if !d.read {
+		if err := d.merge(); err != nil {
+			return nil, err
+		}
+		d.read = true
+	}
+
+	rest := d.entries[d.pos:]
+	if count <= 0 {
+		d.pos = len(d.entries)
+		return rest, nil
+	}
+
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+
+	if count > len(rest) {
+		count = len(rest)
+	}
+	d.pos += count
+	return rest[:count], nil
+}
+
+func (d *overlayDir) merge() error {
+	var (
+		seen   = map[string]bool{}
+		hidden = map[string]bool{}
+	)
+
+	for k := range d.hidden {
+		hidden[k] = true
+	}
+
+	for _, f := range d.dirs {
+		fis, err := f.Readdir(-1)
+		if err != nil {
+			return err
+		}
+
+		// whiteouts only hide entries in lower layers
+		var wh []string
+		for _, fi := range fis {
+			name := fi.Name()
+			if strings.HasPrefix(name, WhiteoutPrefix) {
+				wh = append(wh, strings.TrimPrefix(name, WhiteoutPrefix))
+				continue
+			}
+
+			if seen[name] || hidden[name] {
+				continue
+			}
+
+			seen[name] = true
+			d.entries = append(d.entries, fi)
+		}
+
+		for _, name := range wh {
+			hidden[name] = true
+		}
+	}
+
+	sort.Slice(d.entries, func(i, j int) bool {
+		return d.entries[i].Name() < d.entries[j].Name()
+	})
+
+	return nil
+}
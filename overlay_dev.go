@@ -0,0 +1,23 @@
+//go:build dev
+// +build dev
+
+package httpsrv
+
+import "net/http"
+
+// staleLayerDir reports whether dir in fs has changed since ld was
+// listed
+func staleLayerDir(fs http.FileSystem, dir string, ld *layerDir) bool {
+	f, err := fs.Open(dir)
+	if err != nil {
+		return true
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return true
+	}
+
+	return !fi.IsDir() || !fi.ModTime().Equal(ld.modTime)
+}
@@ -0,0 +1,10 @@
+//go:build !dev
+// +build !dev
+
+package httpsrv
+
+import "net/http"
+
+func staleLayerDir(fs http.FileSystem, dir string, ld *layerDir) bool {
+	return false
+}
@@ -0,0 +1,195 @@
+package httpsrv
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+	"testing/fstest"
+)
+
+func newTestOverlay(layers ...fstest.MapFS) *Overlay {
+	o := NewOverlay()
+	for _, l := range layers {
+		o.AddLayerFS(l)
+	}
+	return o
+}
+
+func file(s string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(s)}
+}
+
+func expectFile(t *testing.T, o *Overlay, name, want string) {
+	t.Helper()
+
+	b, err := ReadFile(o, name)
+	if err != nil {
+		t.Errorf("%s: unexpected error %v", name, err)
+		return
+	}
+	if string(b) != want {
+		t.Errorf("%s: expected %q, got %q", name, want, b)
+	}
+}
+
+func expectMissing(t *testing.T, o *Overlay, name string) {
+	t.Helper()
+
+	if f, err := o.Open(name); !errors.Is(err, fs.ErrNotExist) {
+		if err == nil {
+			f.Close()
+		}
+		t.Errorf("%s: expected ErrNotExist, got %v", name, err)
+	}
+}
+
+func listing(t *testing.T, o *Overlay, name string) []string {
+	t.Helper()
+
+	f, err := o.Open(name)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	defer f.Close()
+
+	fis, err := f.Readdir(-1)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+
+	names := []string{}
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestOverlayShadowing(t *testing.T) {
+	o := newTestOverlay(
+		fstest.MapFS{"a.txt": file("low"), "b.txt": file("low")},
+		fstest.MapFS{"a.txt": file("high")},
+	)
+
+	expectFile(t, o, "/a.txt", "high")
+	expectFile(t, o, "/b.txt", "low")
+	expectMissing(t, o, "/c.txt")
+}
+
+func TestOverlayFileShadowsDir(t *testing.T) {
+	o := newTestOverlay(
+		fstest.MapFS{"a/b.txt": file("low"), "c.txt": file("low")},
+		fstest.MapFS{"a": file("high"), "c.txt/d.txt": file("high")},
+	)
+
+	expectFile(t, o, "/a", "high")
+	expectMissing(t, o, "/a/b.txt")
+
+	// and a directory shadows a file
+	expectFile(t, o, "/c.txt/d.txt", "high")
+	if fi, err := statName(o, "/c.txt"); err != nil || !fi.IsDir() {
+		t.Errorf("expected /c.txt to be a directory, got %v, %v", fi, err)
+	}
+}
+
+func TestOverlayWhiteouts(t *testing.T) {
+	o := newTestOverlay(
+		fstest.MapFS{
+			"img/logo.png":   file("low"),
+			"css/site.css":   file("low"),
+			"css/print.css":  file("low"),
+			"a.txt":          file("low"),
+			"js/app.js":      file("low"),
+			"js/lib/util.js": file("low"),
+		},
+		fstest.MapFS{
+			".wh.img":           file(""),
+			".wh.a.txt":         file(""),
+			"a.txt":             file("high"),
+			"css/.wh.print.css": file(""),
+			".wh.js":            file(""),
+			"js/lib/util.js":    file("high"),
+		},
+	)
+
+	// a parent whiteout hides everything under it
+	expectMissing(t, o, "/img/logo.png")
+	expectMissing(t, o, "/img")
+	expectMissing(t, o, "/.wh.img")
+	expectFile(t, o, "/css/site.css", "low")
+	expectMissing(t, o, "/css/print.css")
+
+	// a whiteout does not hide files in its own layer
+	expectFile(t, o, "/a.txt", "high")
+	expectFile(t, o, "/js/lib/util.js", "high")
+	expectMissing(t, o, "/js/app.js")
+
+	if got := listing(t, o, "/"); !reflect.DeepEqual(got, []string{"a.txt", "css", "js"}) {
+		t.Errorf("unexpected root listing %v", got)
+	}
+	if got := listing(t, o, "/js"); !reflect.DeepEqual(got, []string{"lib"}) {
+		t.Errorf("unexpected js listing %v", got)
+	}
+}
+
+func TestOverlayOpaque(t *testing.T) {
+	o := newTestOverlay(
+		fstest.MapFS{"theme/a.css": file("low"), "theme/b.css": file("low"), "other.txt": file("low")},
+		fstest.MapFS{"theme/" + WhiteoutOpaque: file(""), "theme/b.css": file("high")},
+	)
+
+	expectMissing(t, o, "/theme/a.css")
+	expectFile(t, o, "/theme/b.css", "high")
+	expectFile(t, o, "/other.txt", "low")
+
+	if got := listing(t, o, "/theme"); !reflect.DeepEqual(got, []string{"b.css"}) {
+		t.Errorf("unexpected listing %v", got)
+	}
+}
+
+func TestOverlayMergedReaddir(t *testing.T) {
+	o := newTestOverlay(
+		fstest.MapFS{"a.txt": file("low"), "dir/x.txt": file("low"), "b.txt": file("low")},
+		fstest.MapFS{"a.txt": file("mid"), "dir/y.txt": file("mid")},
+		fstest.MapFS{"c.txt": file("high"), "dir/x.txt": file("high")},
+	)
+
+	if got := listing(t, o, "/"); !reflect.DeepEqual(got, []string{"a.txt", "b.txt", "c.txt", "dir"}) {
+		t.Errorf("unexpected root listing %v", got)
+	}
+	if got := listing(t, o, "/dir"); !reflect.DeepEqual(got, []string{"x.txt", "y.txt"}) {
+		t.Errorf("unexpected dir listing %v", got)
+	}
+
+	o.Remove("/dir/y.txt")
+	if got := listing(t, o, "/dir"); !reflect.DeepEqual(got, []string{"x.txt"}) {
+		t.Errorf("unexpected listing after Remove %v", got)
+	}
+	expectMissing(t, o, "/dir/y.txt")
+
+	o.Restore("/dir/y.txt")
+	expectFile(t, o, "/dir/y.txt", "mid")
+}
+
+func TestOverlayInvalidate(t *testing.T) {
+	high := fstest.MapFS{"a.txt": file("high")}
+	o := newTestOverlay(fstest.MapFS{"b.txt": file("low")}, high)
+
+	expectFile(t, o, "/a.txt", "high")
+
+	high["b.txt"] = file("high")
+	o.Invalidate()
+	expectFile(t, o, "/b.txt", "high")
+}
+
+func statName(fsys http.FileSystem, name string) (fs.FileInfo, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
@@ -1,14 +1,23 @@
 package httpsrv
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"net/textproto"
+	"reflect"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	uuid "github.com/satori/go.uuid"
 )
 
-// ReqValue is a value pulled from the request
+// ReqValue is a value pulled from the request. An empty ReqValue is
+// treated as missing by the error returning accessors. Use ReqValues,
+// e.g. via QueryValues, to tell an empty value from an absent one or to
+// name the key in errors.
 type ReqValue string
 
 func (r ReqValue) String() string {
@@ -38,6 +47,573 @@ func (r ReqValue) UUID() uuid.UUID {
 	return uuid.FromStringOrNil(string(r))
 }
 
+// values returns r as ReqValues, missing if r is empty
+func (r ReqValue) values() ReqValues {
+	if r == "" {
+		return ReqValues{}
+	}
+	return ReqValues{vals: []string{string(r)}}
+}
+
+// Exists returns whether r is not empty
+func (r ReqValue) Exists() bool {
+	return r != ""
+}
+
+// Required returns r as ReqValues that fail with ErrMissingValue when
+// r is empty, e.g. to add Rules
+func (r ReqValue) Required() ReqValues {
+	return r.values().Required()
+}
+
+// Int64 returns r as an int64
+func (r ReqValue) Int64() int64 {
+	v, _ := r.values().Int64E()
+	return v
+}
+
+// Uint returns r as a uint
+func (r ReqValue) Uint() uint {
+	v, _ := r.values().UintE()
+	return v
+}
+
+// Duration returns r as a time.Duration
+func (r ReqValue) Duration() time.Duration {
+	v, _ := r.values().DurationE()
+	return v
+}
+
+// Time returns r as a time.Time formatted as RFC3339 or unix seconds
+func (r ReqValue) Time() time.Time {
+	v, _ := r.values().TimeE()
+	return v
+}
+
+// StringE returns r as a string, failing with ErrMissingValue if r is empty or
+// an error if r cannot be parsed
+func (r ReqValue) StringE() (string, error) {
+	return r.values().Required().StringE()
+}
+
+// StringOr returns r as a string or def if r is empty or invalid
+func (r ReqValue) StringOr(def string) string {
+	return r.values().StringOr(def)
+}
+
+// BoolE returns r as a bool, failing with ErrMissingValue if r is empty or
+// an error if r cannot be parsed
+func (r ReqValue) BoolE() (bool, error) {
+	return r.values().Required().BoolE()
+}
+
+// BoolOr returns r as a bool or def if r is empty or invalid
+func (r ReqValue) BoolOr(def bool) bool {
+	return r.values().BoolOr(def)
+}
+
+// IntE returns r as an int, failing with ErrMissingValue if r is empty or
+// an error if r cannot be parsed
+func (r ReqValue) IntE() (int, error) {
+	return r.values().Required().IntE()
+}
+
+// IntOr returns r as an int or def if r is empty or invalid
+func (r ReqValue) IntOr(def int) int {
+	return r.values().IntOr(def)
+}
+
+// Int64E returns r as an int64, failing with ErrMissingValue if r is empty or
+// an error if r cannot be parsed
+func (r ReqValue) Int64E() (int64, error) {
+	return r.values().Required().Int64E()
+}
+
+// Int64Or returns r as an int64 or def if r is empty or invalid
+func (r ReqValue) Int64Or(def int64) int64 {
+	return r.values().Int64Or(def)
+}
+
+// UintE returns r as a uint, failing with ErrMissingValue if r is empty or
+// an error if r cannot be parsed
+func (r ReqValue) UintE() (uint, error) {
+	return r.values().Required().UintE()
+}
+
+// UintOr returns r as a uint or def if r is empty or invalid
+func (r ReqValue) UintOr(def uint) uint {
+	return r.values().UintOr(def)
+}
+
+// Float64E returns r as a float64, failing with ErrMissingValue if r is empty or
+// an error if r cannot be parsed
+func (r ReqValue) Float64E() (float64, error) {
+	return r.values().Required().Float64E()
+}
+
+// Float64Or returns r as a float64 or def if r is empty or invalid
+func (r ReqValue) Float64Or(def float64) float64 {
+	return r.values().Float64Or(def)
+}
+
+// DurationE returns r as a time.Duration, failing with ErrMissingValue if r is empty or
+// an error if r cannot be parsed
+func (r ReqValue) DurationE() (time.Duration, error) {
+	return r.values().Required().DurationE()
+}
+
+// DurationOr returns r as a time.Duration or def if r is empty or invalid
+func (r ReqValue) DurationOr(def time.Duration) time.Duration {
+	return r.values().DurationOr(def)
+}
+
+// TimeE returns r as a time.Time, failing with ErrMissingValue if r is empty or
+// an error if r cannot be parsed
+func (r ReqValue) TimeE() (time.Time, error) {
+	return r.values().Required().TimeE()
+}
+
+// TimeOr returns r as a time.Time or def if r is empty or invalid
+func (r ReqValue) TimeOr(def time.Time) time.Time {
+	return r.values().TimeOr(def)
+}
+
+// UUIDE returns r as a uuid.UUID, failing with ErrMissingValue if r is empty or
+// an error if r cannot be parsed
+func (r ReqValue) UUIDE() (uuid.UUID, error) {
+	return r.values().Required().UUIDE()
+}
+
+// UUIDOr returns r as a uuid.UUID or def if r is empty or invalid
+func (r ReqValue) UUIDOr(def uuid.UUID) uuid.UUID {
+	return r.values().UUIDOr(def)
+}
+
+// NewReqValues returns a ReqValues for key from the provided source
+// (e.g. "query") holding vals
+func NewReqValues(source, key string, vals ...string) ReqValues {
+	return ReqValues{source: source, key: key, vals: vals}
+}
+
+// ReqValues are the values for a key pulled from the request. Unlike
+// ReqValue they know whether the key was present and report parse
+// and validation errors.
+type ReqValues struct {
+	source   string
+	key      string
+	vals     []string
+	required bool
+	rules    []rule
+	// readErr is set when the part of the request holding r could
+	// not be read, e.g. a malformed form body
+	readErr error
+}
+
+func (r ReqValues) String() string {
+	if len(r.vals) == 0 {
+		return ""
+	}
+
+	return r.vals[0]
+}
+
+// Key returns the name r was looked up with
+func (r ReqValues) Key() string {
+	return r.key
+}
+
+// Source returns where in the request r was found
+func (r ReqValues) Source() string {
+	return r.source
+}
+
+// Exists returns whether r was present in the request
+func (r ReqValues) Exists() bool {
+	return len(r.vals) > 0
+}
+
+// Required returns a copy of r whose error returning accessors
+// fail with ErrMissingValue when r is not present
+func (r ReqValues) Required() ReqValues {
+	r.required = true
+	return r
+}
+
+// Rules returns a copy of r whose error returning accessors validate
+// the converted value against rules, e.g. "required,min=1,max=100".
+// See Validate for the supported rules.
+func (r ReqValues) Rules(rules string) ReqValues {
+	parsed, err := parseRules(rules)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, ru := range parsed {
+		if ru.name == "required" {
+			r.required = true
+		}
+	}
+
+	r.rules = append(append([]rule{}, r.rules...), parsed...)
+	return r
+}
+
+// check validates v against the rules attached to r if conversion
+// was successful
+func (r ReqValues) check(v interface{}, err error) error {
+	if err != nil || len(r.rules) == 0 || !r.Exists() {
+		return err
+	}
+
+	for _, ru := range r.rules {
+		// required means present, which parse has already checked
+		if ru.name == "required" {
+			continue
+		}
+
+		if err := ru.check(reflect.ValueOf(v)); err != nil {
+			return r.err(err)
+		}
+	}
+
+	return nil
+}
+
+// Values returns every value for r in the order they were found
+func (r ReqValues) Values() []string {
+	return r.vals
+}
+
+// Strings returns every value for r, splitting comma separated values
+func (r ReqValues) Strings() []string {
+	var out []string
+	for _, v := range r.vals {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+	}
+
+	return out
+}
+
+// StringE returns r as a string, failing if r is required and missing
+func (r ReqValues) StringE() (string, error) {
+	if r.readErr != nil {
+		return "", r.err(r.readErr)
+	}
+	if !r.Exists() && r.required {
+		return "", r.err(ErrMissingValue)
+	}
+
+	return r.String(), r.check(r.String(), nil)
+}
+
+// StringOr returns r or def if r is not present
+func (r ReqValues) StringOr(def string) string {
+	if !r.Exists() {
+		return def
+	}
+
+	return r.String()
+}
+
+func (r ReqValues) err(err error) *ParamError {
+	return &ParamError{Source: r.source, Key: r.key, Value: r.String(), Err: err}
+}
+
+// parse runs fn on the value of r. Missing values are only
+// an error when r is required.
+func (r ReqValues) parse(fn func(string) error) error {
+	if r.readErr != nil {
+		return r.err(r.readErr)
+	}
+
+	if !r.Exists() {
+		if r.required {
+			return r.err(ErrMissingValue)
+		}
+		return nil
+	}
+
+	if err := fn(r.String()); err != nil {
+		return r.err(err)
+	}
+
+	return nil
+}
+
+// parseAll runs fn on each comma separated value of r
+func (r ReqValues) parseAll(fn func(string) error) error {
+	if r.readErr != nil {
+		return r.err(r.readErr)
+	}
+
+	strs := r.Strings()
+	if len(strs) == 0 && r.required {
+		return r.err(ErrMissingValue)
+	}
+
+	for _, s := range strs {
+		if err := fn(s); err != nil {
+			return &ParamError{Source: r.source, Key: r.key, Value: s, Err: err}
+		}
+	}
+
+	return nil
+}
+
+// Bool returns r as a bool
+func (r ReqValues) Bool() bool {
+	v, _ := r.BoolE()
+	return v
+}
+
+// BoolE returns r as a bool or an error if r cannot be parsed
+func (r ReqValues) BoolE() (v bool, err error) {
+	err = r.parse(func(s string) (err error) {
+		v, err = strconv.ParseBool(s)
+		return err
+	})
+	return v, r.check(v, err)
+}
+
+// BoolOr returns r as a bool or def if r is missing or invalid
+func (r ReqValues) BoolOr(def bool) bool {
+	if v, err := r.BoolE(); err == nil && r.Exists() {
+		return v
+	}
+	return def
+}
+
+// Int returns r as an int
+func (r ReqValues) Int() int {
+	v, _ := r.IntE()
+	return v
+}
+
+// IntE returns r as an int or an error if r cannot be parsed
+func (r ReqValues) IntE() (v int, err error) {
+	err = r.parse(func(s string) (err error) {
+		v, err = strconv.Atoi(s)
+		return err
+	})
+	return v, r.check(v, err)
+}
+
+// IntOr returns r as an int or def if r is missing or invalid
+func (r ReqValues) IntOr(def int) int {
+	if v, err := r.IntE(); err == nil && r.Exists() {
+		return v
+	}
+	return def
+}
+
+// Ints returns every comma separated value of r as an int
+func (r ReqValues) Ints() ([]int, error) {
+	var out []int
+	err := r.parseAll(func(s string) error {
+		v, err := strconv.Atoi(s)
+		out = append(out, v)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, r.check(out, nil)
+}
+
+// Int64 returns r as an int64
+func (r ReqValues) Int64() int64 {
+	v, _ := r.Int64E()
+	return v
+}
+
+// Int64E returns r as an int64 or an error if r cannot be parsed
+func (r ReqValues) Int64E() (v int64, err error) {
+	err = r.parse(func(s string) (err error) {
+		v, err = strconv.ParseInt(s, 10, 64)
+		return err
+	})
+	return v, r.check(v, err)
+}
+
+// Int64Or returns r as an int64 or def if r is missing or invalid
+func (r ReqValues) Int64Or(def int64) int64 {
+	if v, err := r.Int64E(); err == nil && r.Exists() {
+		return v
+	}
+	return def
+}
+
+// Int64s returns every comma separated value of r as an int64
+func (r ReqValues) Int64s() ([]int64, error) {
+	var out []int64
+	err := r.parseAll(func(s string) error {
+		v, err := strconv.ParseInt(s, 10, 64)
+		out = append(out, v)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, r.check(out, nil)
+}
+
+// Uint returns r as a uint
+func (r ReqValues) Uint() uint {
+	v, _ := r.UintE()
+	return v
+}
+
+// UintE returns r as a uint or an error if r cannot be parsed
+func (r ReqValues) UintE() (v uint, err error) {
+	err = r.parse(func(s string) error {
+		n, err := strconv.ParseUint(s, 10, 0)
+		v = uint(n)
+		return err
+	})
+	return v, r.check(v, err)
+}
+
+// UintOr returns r as a uint or def if r is missing or invalid
+func (r ReqValues) UintOr(def uint) uint {
+	if v, err := r.UintE(); err == nil && r.Exists() {
+		return v
+	}
+	return def
+}
+
+// Float64 returns r as a float64
+func (r ReqValues) Float64() float64 {
+	v, _ := r.Float64E()
+	return v
+}
+
+// Float64E returns r as a float64 or an error if r cannot be parsed
+func (r ReqValues) Float64E() (v float64, err error) {
+	err = r.parse(func(s string) (err error) {
+		v, err = strconv.ParseFloat(s, 64)
+		return err
+	})
+	return v, r.check(v, err)
+}
+
+// Float64Or returns r as a float64 or def if r is missing or invalid
+func (r ReqValues) Float64Or(def float64) float64 {
+	if v, err := r.Float64E(); err == nil && r.Exists() {
+		return v
+	}
+	return def
+}
+
+// Float64s returns every comma separated value of r as a float64
+func (r ReqValues) Float64s() ([]float64, error) {
+	var out []float64
+	err := r.parseAll(func(s string) error {
+		v, err := strconv.ParseFloat(s, 64)
+		out = append(out, v)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, r.check(out, nil)
+}
+
+// Duration returns r as a time.Duration
+func (r ReqValues) Duration() time.Duration {
+	v, _ := r.DurationE()
+	return v
+}
+
+// DurationE returns r as a time.Duration or an error if r cannot be parsed
+func (r ReqValues) DurationE() (v time.Duration, err error) {
+	err = r.parse(func(s string) (err error) {
+		v, err = time.ParseDuration(s)
+		return err
+	})
+	return v, r.check(v, err)
+}
+
+// DurationOr returns r as a time.Duration or def if r is missing or invalid
+func (r ReqValues) DurationOr(def time.Duration) time.Duration {
+	if v, err := r.DurationE(); err == nil && r.Exists() {
+		return v
+	}
+	return def
+}
+
+// Time returns r as a time.Time
+func (r ReqValues) Time() time.Time {
+	v, _ := r.TimeE()
+	return v
+}
+
+// TimeE returns r as a time.Time or an error if r cannot be parsed.
+// Values may be formatted as RFC3339 or as unix seconds.
+func (r ReqValues) TimeE() (v time.Time, err error) {
+	err = r.parse(func(s string) (err error) {
+		v, err = parseTime(s)
+		return err
+	})
+	return v, r.check(v, err)
+}
+
+// TimeOr returns r as a time.Time or def if r is missing or invalid
+func (r ReqValues) TimeOr(def time.Time) time.Time {
+	if v, err := r.TimeE(); err == nil && r.Exists() {
+		return v
+	}
+	return def
+}
+
+func parseTime(s string) (time.Time, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(n, 0).UTC(), nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
+
+// UUID returns r as a UUID
+func (r ReqValues) UUID() uuid.UUID {
+	v, _ := r.UUIDE()
+	return v
+}
+
+// UUIDE returns r as a UUID or an error if r cannot be parsed
+func (r ReqValues) UUIDE() (v uuid.UUID, err error) {
+	err = r.parse(func(s string) (err error) {
+		v, err = uuid.FromString(s)
+		return err
+	})
+	return v, r.check(v, err)
+}
+
+// UUIDOr returns r as a UUID or def if r is missing or invalid
+func (r ReqValues) UUIDOr(def uuid.UUID) uuid.UUID {
+	if v, err := r.UUIDE(); err == nil && r.Exists() {
+		return v
+	}
+	return def
+}
+
+// UUIDs returns every comma separated value of r as a UUID
+func (r ReqValues) UUIDs() ([]uuid.UUID, error) {
+	var out []uuid.UUID
+	err := r.parseAll(func(s string) error {
+		v, err := uuid.FromString(s)
+		out = append(out, v)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, r.check(out, nil)
+}
+
 // ParamValue returns a ReqValue from the url path
 func ParamValue(r *http.Request, key string) ReqValue {
 	return ReqValue(httprouter.ParamsFromContext(r.Context()).ByName(key))
@@ -47,3 +623,123 @@ func ParamValue(r *http.Request, key string) ReqValue {
 func QueryValue(r *http.Request, key string) ReqValue {
 	return ReqValue(r.URL.Query().Get(key))
 }
+
+// HeaderValue returns a ReqValue from the request headers
+func HeaderValue(r *http.Request, key string) ReqValue {
+	return ReqValue(r.Header.Get(key))
+}
+
+// CookieValue returns a ReqValue from the first cookie named key
+func CookieValue(r *http.Request, key string) ReqValue {
+	return ReqValue(CookieValues(r, key).String())
+}
+
+// FormValue returns a ReqValue from the url encoded or multipart form
+// body, falling back to the query string like http.Request.FormValue
+func FormValue(r *http.Request, key string) ReqValue {
+	return ReqValue(FormValues(r, key).String())
+}
+
+// PostFormValue returns a ReqValue from the url encoded or multipart
+// form body, ignoring the query string
+func PostFormValue(r *http.Request, key string) ReqValue {
+	return ReqValue(PostFormValues(r, key).String())
+}
+
+// ParamValues returns ReqValues from the url path
+func ParamValues(r *http.Request, key string) ReqValues {
+	var (
+		ps   = httprouter.ParamsFromContext(r.Context())
+		vals []string
+	)
+
+	for _, p := range ps {
+		if p.Key == key {
+			vals = append(vals, p.Value)
+			break
+		}
+	}
+
+	return NewReqValues("path", key, vals...)
+}
+
+// QueryValues returns ReqValues from the query string
+func QueryValues(r *http.Request, key string) ReqValues {
+	return NewReqValues("query", key, r.URL.Query()[key]...)
+}
+
+// HeaderValues returns ReqValues from the request headers
+func HeaderValues(r *http.Request, key string) ReqValues {
+	return NewReqValues("header", key, r.Header[textproto.CanonicalMIMEHeaderKey(key)]...)
+}
+
+// CookieValues returns ReqValues from the request cookies. Every
+// cookie sent with name key is available via Values.
+func CookieValues(r *http.Request, key string) ReqValues {
+	var vals []string
+	for _, c := range r.Cookies() {
+		if c.Name == key {
+			vals = append(vals, c.Value)
+		}
+	}
+
+	return NewReqValues("cookie", key, vals...)
+}
+
+// defaultMaxMemory mirrors the limit net/http uses when parsing
+// multipart forms via Request.FormValue
+const defaultMaxMemory = 32 << 20
+
+func parseForm(r *http.Request) error {
+	if b, ok := r.Body.(*formErrorBody); ok {
+		return b.err
+	}
+	if r.Form != nil {
+		return nil
+	}
+
+	// ParseMultipartForm reports ErrNotMultipart rather than errors
+	// parsing url encoded bodies, so those are parsed first
+	err := r.ParseForm()
+	if err == nil {
+		err = r.ParseMultipartForm(defaultMaxMemory)
+	}
+	if err == nil || errors.Is(err, http.ErrNotMultipart) {
+		return nil
+	}
+
+	body := r.Body
+	if body == nil {
+		body = http.NoBody
+	}
+	r.Body = &formErrorBody{ReadCloser: body, err: err}
+	return err
+}
+
+// formErrorBody replaces a request body that failed to parse as a form
+// so later lookups report the same error
+type formErrorBody struct {
+	io.ReadCloser
+	err error
+}
+
+// FormValues returns ReqValues from the url encoded or multipart form
+// body, falling back to the query string like http.Request.FormValue.
+// A malformed body is reported by the error returning accessors.
+func FormValues(r *http.Request, key string) ReqValues {
+	v := NewReqValues("form", key)
+	if v.readErr = parseForm(r); v.readErr == nil {
+		v.vals = r.Form[key]
+	}
+	return v
+}
+
+// PostFormValues returns ReqValues from the url encoded or multipart
+// form body, ignoring the query string
+func PostFormValues(r *http.Request, key string) ReqValues {
+	v := NewReqValues("form", key)
+	if v.readErr = parseForm(r); v.readErr == nil {
+		v.vals = r.PostForm[key]
+	}
+	return v
+}
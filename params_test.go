@@ -0,0 +1,126 @@
+package httpsrv
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReqValueE(t *testing.T) {
+	r := httptest.NewRequest("GET", "/?n=12&bad=abc&d=1m&t=1700000000", nil)
+
+	if v, err := QueryValue(r, "n").IntE(); err != nil || v != 12 {
+		t.Errorf("expected 12, got %d, %v", v, err)
+	}
+
+	if _, err := QueryValue(r, "missing").IntE(); !errors.Is(err, ErrMissingValue) {
+		t.Errorf("expected ErrMissingValue, got %v", err)
+	}
+
+	_, err := QueryValue(r, "bad").IntE()
+	if err == nil || errors.Is(err, ErrMissingValue) {
+		t.Fatalf("expected a parse error, got %v", err)
+	}
+	if err.Error() != `invalid value "abc": strconv.Atoi: parsing "abc": invalid syntax` {
+		t.Errorf("unexpected error %q", err)
+	}
+
+	if v, err := QueryValue(r, "d").DurationE(); err != nil || v != time.Minute {
+		t.Errorf("expected 1m, got %s, %v", v, err)
+	}
+	if v := QueryValue(r, "t").Time(); !v.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("unexpected time %s", v)
+	}
+}
+
+func TestReqValueOr(t *testing.T) {
+	r := httptest.NewRequest("GET", "/?n=12&bad=abc", nil)
+
+	for key, want := range map[string]int{"n": 12, "bad": 5, "missing": 5} {
+		if v := QueryValue(r, key).IntOr(5); v != want {
+			t.Errorf("%s: expected %d, got %d", key, want, v)
+		}
+	}
+
+	if v := QueryValue(r, "missing").Int(); v != 0 {
+		t.Errorf("expected 0, got %d", v)
+	}
+}
+
+func TestReqValueRequiredRules(t *testing.T) {
+	r := httptest.NewRequest("GET", "/?n=0", nil)
+
+	if _, err := QueryValue(r, "n").Required().Rules("min=1").IntE(); err == nil {
+		t.Error("expected min error")
+	}
+	if _, err := QueryValue(r, "missing").Required().IntE(); !errors.Is(err, ErrMissingValue) {
+		t.Errorf("expected ErrMissingValue, got %v", err)
+	}
+}
+
+func TestReqValues(t *testing.T) {
+	r := httptest.NewRequest("GET", "/?id=1,2&id=3&empty=&bad=1,x", nil)
+
+	ids, err := QueryValues(r, "id").Ints()
+	if err != nil || len(ids) != 3 || ids[2] != 3 {
+		t.Errorf("unexpected ids %v, %v", ids, err)
+	}
+
+	if v := QueryValues(r, "empty"); !v.Exists() || v.String() != "" {
+		t.Error("empty value should exist")
+	}
+	if v := QueryValue(r, "empty"); v.Exists() {
+		t.Error("empty ReqValue should be missing")
+	}
+
+	var perr *ParamError
+	if _, err := QueryValues(r, "bad").Ints(); !errors.As(err, &perr) || perr.Key != "bad" || perr.Value != "x" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if perr.StatusCode() != 400 {
+		t.Errorf("expected 400, got %d", perr.StatusCode())
+	}
+}
+
+func TestFormValues(t *testing.T) {
+	r := httptest.NewRequest("POST", "/?q=1", strings.NewReader("a=1&a=2&b=x"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if v := FormValues(r, "a").Values(); len(v) != 2 {
+		t.Errorf("unexpected values %v", v)
+	}
+	if v := FormValue(r, "q"); v != "1" {
+		t.Errorf("expected query fallback, got %q", v)
+	}
+	if v := PostFormValues(r, "q"); v.Exists() {
+		t.Error("PostFormValues should ignore the query string")
+	}
+}
+
+func TestFormValuesMalformed(t *testing.T) {
+	for ct, body := range map[string]string{
+		"application/x-www-form-urlencoded": "a=%zz",
+		"multipart/form-data; boundary=xyz": "--xyz\r\nnot a part",
+	} {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		r.Header.Set("Content-Type", ct)
+
+		for i := 0; i < 2; i++ {
+			var perr *ParamError
+			_, err := FormValues(r, "a").StringE()
+			if !errors.As(err, &perr) || perr.Source != "form" || errors.Is(err, ErrMissingValue) {
+				t.Errorf("%s: expected form error, got %v", ct, err)
+			}
+		}
+
+		var dst struct {
+			A string `form:"a"`
+		}
+		err := Bind(r, &dst)
+		if errs, ok := err.(ParamErrors); !ok || len(errs) != 1 || errs.StatusCode() != 400 {
+			t.Errorf("%s: expected a 400 ParamErrors, got %v", ct, err)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package httpsrv
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jonasi/ctxlog"
+)
+
+// ErrRateLimited is written with a 429 when a client exceeds its limit
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// RateLimitAlgorithm selects how requests are counted
+type RateLimitAlgorithm int
+
+const (
+	// TokenBucket allows bursts of up to Requests that refill evenly
+	// over Window
+	TokenBucket RateLimitAlgorithm = iota
+	// SlidingWindow allows Requests in any Window, approximated by
+	// weighting the previous fixed window
+	SlidingWindow
+)
+
+// RateLimit is the number of requests allowed per window
+type RateLimit struct {
+	Requests  int
+	Window    time.Duration
+	Algorithm RateLimitAlgorithm
+}
+
+// RateLimitResult is the outcome of taking a request from a limit
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the limit is fully available again, or
+	// until the next request is allowed when denied
+	Reset time.Duration
+}
+
+// RateLimitStore tracks rate limit state by key. Implementations backed
+// by a shared store allow limits to be enforced across processes.
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+}
+
+// KeyByIP keys requests by the ip of the client connection
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// KeyByHeader returns a key func that keys requests by the value of
+// header h, falling back to the client ip if it is missing
+func KeyByHeader(h string) func(*http.Request) string {
+	return func(r *http.Request) string {
+		if v := r.Header.Get(h); v != "" {
+			return h + ":" + v
+		}
+		return KeyByIP(r)
+	}
+}
+
+// KeyByIdentity returns a key func that keys requests by the user
+// returned by identity, e.g. the basic auth username, falling back to
+// the client ip for anonymous requests
+func KeyByIdentity(identity func(*http.Request) string) func(*http.Request) string {
+	return func(r *http.Request) string {
+		if u := identity(r); u != "" {
+			return "user:" + u
+		}
+		return KeyByIP(r)
+	}
+}
+
+// RateLimitConf configures the rate limit middleware
+type RateLimitConf struct {
+	Limit RateLimit
+	// Key identifies the client making a request, e.g. by ip, api
+	// key header or authenticated user. Defaults to KeyByIP.
+	Key func(*http.Request) string
+	// Store defaults to a MemoryRateLimitStore
+	Store RateLimitStore
+	// PerRoute gives each route its own limit instead of sharing one
+	// across every route the middleware is applied to
+	PerRoute bool
+}
+
+// Middleware returns a Middleware that writes a 429 with WriteError
+// when a client exceeds the limit. RateLimit-Limit, RateLimit-Remaining
+// and RateLimit-Reset headers are set on every response and Retry-After
+// on limited ones. A rate limit registered on a route replaces any
+// registered globally. If the store fails, requests are allowed.
+func (c RateLimitConf) Middleware() Middleware {
+	key := c.Key
+	if key == nil {
+		key = KeyByIP
+	}
+
+	store := c.Store
+	if store == nil {
+		store = NewMemoryRateLimitStore()
+	}
+
+	return replacingMiddleware("rate_limit", func(method, path string, h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k := key(r)
+			if c.PerRoute {
+				k = method + " " + path + "|" + k
+			}
+
+			res, err := store.Take(r.Context(), k, c.Limit)
+			if err != nil {
+				ctxlog.Errorf(r.Context(), "Rate limit store error: %s", err)
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			reset := strconv.Itoa(int(math.Ceil(res.Reset.Seconds())))
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Reset", reset)
+
+			if !res.Allowed {
+				w.Header().Set("Retry-After", reset)
+				WriteError(w, r, NewStatusError(http.StatusTooManyRequests, ErrRateLimited))
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	})
+}
+
+const rateLimitShards = 32
+
+// NewMemoryRateLimitStore returns an initialized *MemoryRateLimitStore
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	s := &MemoryRateLimitStore{now: time.Now}
+	for i := range s.shards {
+		s.shards[i].entries = map[string]*rateLimitEntry{}
+	}
+	return s
+}
+
+// MemoryRateLimitStore is an in process RateLimitStore. Keys are spread
+// across shards to reduce lock contention and are evicted once their
+// limit has fully reset.
+type MemoryRateLimitStore struct {
+	shards [rateLimitShards]rateLimitShard
+	now    func() time.Time
+}
+
+type rateLimitShard struct {
+	mu        sync.Mutex
+	entries   map[string]*rateLimitEntry
+	lastSweep time.Time
+}
+
+type rateLimitEntry struct {
+	// token bucket
+	tokens float64
+	// sliding window
+	windowStart time.Time
+	prev, cur   int
+
+	last    time.Time
+	expires time.Time
+}
+
+// Take satisfies RateLimitStore
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	if limit.Requests <= 0 || limit.Window <= 0 {
+		return RateLimitResult{}, errors.New("invalid rate limit")
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+
+	var (
+		sh  = &s.shards[h.Sum32()%rateLimitShards]
+		now = s.now()
+	)
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if now.Sub(sh.lastSweep) > time.Minute {
+		for k, e := range sh.entries {
+			if now.After(e.expires) {
+				delete(sh.entries, k)
+			}
+		}
+		sh.lastSweep = now
+	}
+
+	e, ok := sh.entries[key]
+	if !ok {
+		e = &rateLimitEntry{tokens: float64(limit.Requests), last: now, windowStart: now}
+		sh.entries[key] = e
+	}
+
+	if limit.Algorithm == SlidingWindow {
+		return e.slidingWindow(now, limit), nil
+	}
+
+	return e.tokenBucket(now, limit), nil
+}
+
+func (e *rateLimitEntry) tokenBucket(now time.Time, limit RateLimit) RateLimitResult {
+	var (
+		max  = float64(limit.Requests)
+		rate = max / limit.Window.Seconds()
+		res  = RateLimitResult{Limit: limit.Requests}
+	)
+
+	e.tokens = math.Min(max, e.tokens+now.Sub(e.last).Seconds()*rate)
+	e.last = now
+
+	if e.tokens >= 1 {
+		e.tokens--
+		res.Allowed = true
+		res.Reset = time.Duration((max - e.tokens) / rate * float64(time.Second))
+	} else {
+		res.Reset = time.Duration((1 - e.tokens) / rate * float64(time.Second))
+	}
+
+	res.Remaining = int(e.tokens)
+	e.expires = now.Add(time.Duration((max - e.tokens) / rate * float64(time.Second)))
+	return res
+}
+
+func (e *rateLimitEntry) slidingWindow(now time.Time, limit RateLimit) RateLimitResult {
+	res := RateLimitResult{Limit: limit.Requests}
+
+	// advance the fixed windows
+	if elapsed := now.Sub(e.windowStart); elapsed >= limit.Window {
+		n := elapsed / limit.Window
+		if n == 1 {
+			e.prev = e.cur
+		} else {
+			e.prev = 0
+		}
+		e.cur = 0
+		e.windowStart = e.windowStart.Add(n * limit.Window)
+	}
+
+	var (
+		into   = now.Sub(e.windowStart)
+		weight = 1 - float64(into)/float64(limit.Window)
+		count  = float64(e.prev)*weight + float64(e.cur)
+	)
+
+	if count < float64(limit.Requests) {
+		e.cur++
+		count++
+		res.Allowed = true
+	}
+
+	res.Remaining = int(math.Max(0, float64(limit.Requests)-math.Ceil(count)))
+	res.Reset = limit.Window - into
+	e.expires = e.windowStart.Add(2 * limit.Window)
+	return res
+}
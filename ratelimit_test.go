@@ -0,0 +1,223 @@
+package httpsrv
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRateLimitStore returns res and err from every Take and records
+// the keys it was called with
+type fakeRateLimitStore struct {
+	res RateLimitResult
+	err error
+
+	mu   sync.Mutex
+	keys []string
+}
+
+func (s *fakeRateLimitStore) Take(_ context.Context, key string, _ RateLimit) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, key)
+	return s.res, s.err
+}
+
+func (s *fakeRateLimitStore) taken() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.keys...)
+}
+
+// serveRateLimited serves a GET /items request through mw and reports
+// whether the handler was called
+func serveRateLimited(mw Middleware) (*httptest.ResponseRecorder, bool) {
+	var (
+		called bool
+		h      = mw.Handler("GET", "/items", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}))
+		w = httptest.NewRecorder()
+	)
+
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/items", nil))
+	return w, called
+}
+
+func TestRateLimitDenied(t *testing.T) {
+	store := &fakeRateLimitStore{res: RateLimitResult{Limit: 10, Reset: 1500 * time.Millisecond}}
+	w, called := serveRateLimited(RateLimitConf{Store: store}.Middleware())
+
+	if called {
+		t.Error("handler called for a limited request")
+	}
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429, got %d", w.Code)
+	}
+
+	for k, v := range map[string]string{
+		"RateLimit-Limit":     "10",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "2",
+		"Retry-After":         "2",
+	} {
+		if got := w.Header().Get(k); got != v {
+			t.Errorf("expected %s %q, got %q", k, v, got)
+		}
+	}
+}
+
+func TestRateLimitAllowed(t *testing.T) {
+	store := &fakeRateLimitStore{res: RateLimitResult{Allowed: true, Limit: 10, Remaining: 9, Reset: time.Second}}
+	w, called := serveRateLimited(RateLimitConf{Store: store}.Middleware())
+
+	if !called {
+		t.Error("handler not called")
+	}
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+	if got := w.Header().Get("RateLimit-Remaining"); got != "9" {
+		t.Errorf("expected RateLimit-Remaining 9, got %q", got)
+	}
+	if got := w.Header().Get("Retry-After"); got != "" {
+		t.Errorf("unexpected Retry-After %q", got)
+	}
+}
+
+func TestRateLimitStoreErrorFailsOpen(t *testing.T) {
+	store := &fakeRateLimitStore{err: errors.New("store down")}
+	w, called := serveRateLimited(RateLimitConf{Store: store}.Middleware())
+
+	if !called {
+		t.Error("handler not called when the store fails")
+	}
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+	if got := w.Header().Get("RateLimit-Limit"); got != "" {
+		t.Errorf("unexpected RateLimit-Limit %q", got)
+	}
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	var (
+		shared   = &fakeRateLimitStore{res: RateLimitResult{Allowed: true}}
+		perRoute = &fakeRateLimitStore{res: RateLimitResult{Allowed: true}}
+	)
+
+	serveRateLimited(RateLimitConf{Store: shared}.Middleware())
+	serveRateLimited(RateLimitConf{Store: perRoute, PerRoute: true}.Middleware())
+
+	if keys := shared.taken(); len(keys) != 1 || keys[0] != "192.0.2.1" {
+		t.Errorf("unexpected shared keys %v", keys)
+	}
+	if keys := perRoute.taken(); len(keys) != 1 || keys[0] != "GET /items|192.0.2.1" {
+		t.Errorf("unexpected per route keys %v", keys)
+	}
+}
+
+func TestRateLimitRouteReplacesGlobal(t *testing.T) {
+	var (
+		global = &fakeRateLimitStore{res: RateLimitResult{Allowed: true}}
+		route  = &fakeRateLimitStore{res: RateLimitResult{Allowed: true}}
+		s      = &Server{middleware: []Middleware{RateLimitConf{Store: global}.Middleware()}}
+	)
+
+	h, ids := s.applyMiddleware("GET", "/items", http.NotFoundHandler(), []Middleware{RateLimitConf{Store: route}.Middleware()})
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/items", nil))
+
+	if len(ids) != 1 || ids[0] != "rate_limit" {
+		t.Errorf("expected a single rate_limit middleware, got %v", ids)
+	}
+	if n := len(global.taken()); n != 0 {
+		t.Errorf("global limit applied %d times", n)
+	}
+	if n := len(route.taken()); n != 1 {
+		t.Errorf("route limit applied %d times", n)
+	}
+}
+
+// memoryStoreAt returns a MemoryRateLimitStore whose clock is *now
+func memoryStoreAt(now *time.Time) *MemoryRateLimitStore {
+	s := NewMemoryRateLimitStore()
+	s.now = func() time.Time { return *now }
+	return s
+}
+
+type takeCase struct {
+	advance   time.Duration
+	allowed   bool
+	remaining int
+	reset     time.Duration
+}
+
+func runTakes(t *testing.T, limit RateLimit, cases []takeCase) {
+	var (
+		now   = time.Unix(1700000000, 0)
+		store = memoryStoreAt(&now)
+	)
+
+	for i, c := range cases {
+		now = now.Add(c.advance)
+
+		res, err := store.Take(context.Background(), "k", limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Allowed != c.allowed || res.Remaining != c.remaining || res.Reset != c.reset {
+			t.Errorf("take %d: expected allowed=%v remaining=%d reset=%s, got allowed=%v remaining=%d reset=%s",
+				i, c.allowed, c.remaining, c.reset, res.Allowed, res.Remaining, res.Reset)
+		}
+	}
+}
+
+func TestMemoryRateLimitStoreTokenBucket(t *testing.T) {
+	runTakes(t, RateLimit{Requests: 2, Window: time.Second, Algorithm: TokenBucket}, []takeCase{
+		{0, true, 1, 500 * time.Millisecond},
+		{0, true, 0, time.Second},
+		// empty until a token refills
+		{0, false, 0, 500 * time.Millisecond},
+		{250 * time.Millisecond, false, 0, 250 * time.Millisecond},
+		{250 * time.Millisecond, true, 0, time.Second},
+		// fully refilled
+		{2 * time.Second, true, 1, 500 * time.Millisecond},
+	})
+}
+
+func TestMemoryRateLimitStoreSlidingWindow(t *testing.T) {
+	runTakes(t, RateLimit{Requests: 2, Window: time.Second, Algorithm: SlidingWindow}, []takeCase{
+		{0, true, 1, time.Second},
+		{0, true, 0, time.Second},
+		{0, false, 0, time.Second},
+		// the previous window still counts in full at its end
+		{time.Second, false, 0, time.Second},
+		// and by half half way through the next
+		{500 * time.Millisecond, true, 0, 500 * time.Millisecond},
+		// two idle windows reset the count
+		{2 * time.Second, true, 1, 500 * time.Millisecond},
+	})
+}
+
+func TestMemoryRateLimitStoreKeys(t *testing.T) {
+	var (
+		now   = time.Unix(1700000000, 0)
+		store = memoryStoreAt(&now)
+		limit = RateLimit{Requests: 1, Window: time.Minute}
+	)
+
+	for _, k := range []string{"a", "b"} {
+		if res, _ := store.Take(context.Background(), k, limit); !res.Allowed {
+			t.Errorf("first request for %s denied", k)
+		}
+	}
+
+	if res, _ := store.Take(context.Background(), "a", limit); res.Allowed {
+		t.Error("second request for a allowed")
+	}
+}
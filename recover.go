@@ -0,0 +1,60 @@
+package httpsrv
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/jonasi/ctxlog"
+)
+
+// PanicReporter is called with every panic recovered by Recover,
+// e.g. to send it to an error tracker
+type PanicReporter func(r *http.Request, v interface{}, stack []byte)
+
+// Recover is a Middleware that recovers panics in handlers
+var Recover = RecoverWith(nil)
+
+// RecoverWith returns a Middleware that recovers panics in handlers,
+// logs them with their stack and writes a 500 with WriteError. If
+// report is non-nil it is called for every recovered panic.
+//
+// Panics with http.ErrAbortHandler are passed through so the server
+// can abort the response. If the response has already started the
+// connection is aborted as well, since a 500 can no longer be sent.
+func RecoverWith(report PanicReporter) Middleware {
+	return MiddlewareFunc("recover", func(method, path string, h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := wrapResponseWriter(w)
+
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+
+				var (
+					stack = debug.Stack()
+					ctx   = ctxlog.WithKV(r.Context(), "route", method+" "+path)
+				)
+
+				ctxlog.Errorf(ctx, "Recovered panic: %v\n%s", v, stack)
+				if report != nil {
+					report(r, v, stack)
+				}
+
+				if rw.Status() != 0 {
+					panic(http.ErrAbortHandler)
+				}
+
+				WriteError(rw, r, fmt.Errorf("panic: %v", v))
+			}()
+
+			h.ServeHTTP(rw, r)
+		})
+	})
+}
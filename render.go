@@ -0,0 +1,219 @@
+package httpsrv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jonasi/ctxlog"
+)
+
+// An Encoder writes response values in a specific media type
+type Encoder interface {
+	ContentType() string
+	Encode(w io.Writer, v interface{}) error
+}
+
+// EncoderFunc is a helper for defining encoders
+func EncoderFunc(contentType string, fn func(io.Writer, interface{}) error) Encoder {
+	return &encoder{ct: contentType, fn: fn}
+}
+
+type encoder struct {
+	ct string
+	fn func(io.Writer, interface{}) error
+}
+
+func (e *encoder) ContentType() string                     { return e.ct }
+func (e *encoder) Encode(w io.Writer, v interface{}) error { return e.fn(w, v) }
+
+// JSONEncoder encodes values as application/json
+var JSONEncoder = EncoderFunc("application/json", func(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+})
+
+// XMLEncoder encodes values as application/xml
+var XMLEncoder = EncoderFunc("application/xml", func(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(v)
+})
+
+// TextEncoder encodes values as text/plain using their fmt representation
+var TextEncoder = EncoderFunc("text/plain", func(w io.Writer, v interface{}) error {
+	_, err := fmt.Fprintln(w, v)
+	return err
+})
+
+// MsgpackEncoder encodes values as application/msgpack
+var MsgpackEncoder = EncoderFunc("application/msgpack", encodeMsgpack)
+
+// CBOREncoder encodes values as application/cbor
+var CBOREncoder = EncoderFunc("application/cbor", encodeCBOR)
+
+// HTMLEncoder returns an Encoder that renders values with t as text/html
+func HTMLEncoder(t *template.Template) Encoder {
+	return EncoderFunc("text/html", func(w io.Writer, v interface{}) error {
+		return t.Execute(w, v)
+	})
+}
+
+// DefaultEncoders are used by Render when the server has no
+// encoders registered
+var DefaultEncoders = []Encoder{JSONEncoder, XMLEncoder, MsgpackEncoder, CBOREncoder, TextEncoder}
+
+type serverKey struct{}
+
+// ServerFromContext returns the Server handling the request ctx belongs to
+func ServerFromContext(ctx context.Context) *Server {
+	s, _ := ctx.Value(serverKey{}).(*Server)
+	return s
+}
+
+// Render writes v to w with the encoder that best matches the Accept
+// header of r. Candidates are the encoders registered with the Server
+// handling r, or DefaultEncoders. The first candidate is used when r
+// accepts anything. If nothing matches, a 406 is written.
+func Render(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	encs := DefaultEncoders
+	if s := ServerFromContext(r.Context()); s != nil && len(s.encoders) > 0 {
+		encs = s.encoders
+	}
+
+	w.Header().Add("Vary", "Accept")
+
+	enc := Negotiate(r, encs)
+	if enc == nil {
+		http.Error(w, http.StatusText(http.StatusNotAcceptable), http.StatusNotAcceptable)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := enc.Encode(&buf, v); err != nil {
+		ctxlog.Errorf(r.Context(), "Error encoding %s response: %s", enc.ContentType(), err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	ct := enc.ContentType()
+	if strings.HasPrefix(ct, "text/") || strings.HasSuffix(ct, "json") || strings.HasSuffix(ct, "xml") {
+		ct += "; charset=utf-8"
+	}
+
+	w.Header().Set("Content-Type", ct)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(status)
+	if _, err := buf.WriteTo(w); err != nil {
+		ctxlog.Errorf(r.Context(), "Error writing %s response: %s", enc.ContentType(), err)
+	}
+}
+
+// Negotiate returns the encoder in encs that best matches the Accept
+// header of r, or nil if none are acceptable
+func Negotiate(r *http.Request, encs []Encoder) Encoder {
+	if len(encs) == 0 {
+		return nil
+	}
+
+	accept := parseAccept(r.Header.Get("Accept"))
+	if len(accept) == 0 {
+		return encs[0]
+	}
+
+	var (
+		best  Encoder
+		bestQ float64
+	)
+
+	for _, enc := range encs {
+		if q := accept.quality(enc.ContentType()); q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+
+	return best
+}
+
+type mediaRange struct {
+	typ, sub string
+	q        float64
+}
+
+type acceptList []mediaRange
+
+func parseAccept(h string) acceptList {
+	var out acceptList
+	for _, part := range strings.Split(h, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		var (
+			params = strings.Split(part, ";")
+			mr     = mediaRange{q: 1}
+		)
+
+		typ := strings.ToLower(strings.TrimSpace(params[0]))
+		if i := strings.IndexByte(typ, '/'); i != -1 {
+			mr.typ, mr.sub = typ[:i], typ[i+1:]
+		} else {
+			mr.typ, mr.sub = typ, "*"
+		}
+
+		for _, p := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+			if len(kv) == 2 && strings.EqualFold(kv[0], "q") {
+				if q, err := strconv.ParseFloat(kv[1], 64); err == nil {
+					mr.q = q
+				}
+			}
+		}
+
+		out = append(out, mr)
+	}
+
+	// most specific ranges first so they take precedence
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].specificity() > out[j].specificity()
+	})
+
+	return out
+}
+
+func (m mediaRange) specificity() int {
+	switch {
+	case m.typ == "*":
+		return 0
+	case m.sub == "*":
+		return 1
+	}
+
+	return 2
+}
+
+// quality returns the q value of the most specific range matching ct
+func (a acceptList) quality(ct string) float64 {
+	var typ, sub string
+	if i := strings.IndexByte(ct, '/'); i != -1 {
+		typ, sub = ct[:i], ct[i+1:]
+	}
+
+	for _, m := range a {
+		if (m.typ == "*" || m.typ == typ) && (m.sub == "*" || m.sub == sub) {
+			return m.q
+		}
+	}
+
+	return 0
+}
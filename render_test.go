@@ -0,0 +1,71 @@
+package httpsrv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	encs := []Encoder{JSONEncoder, XMLEncoder, MsgpackEncoder, TextEncoder}
+
+	for accept, want := range map[string]string{
+		"":                "application/json",
+		"*/*":             "application/json",
+		"application/xml": "application/xml",
+		"text/*":          "text/plain",
+		"application/json;q=0.5, application/xml":        "application/xml",
+		"application/*;q=0.2, application/msgpack;q=0.9": "application/msgpack",
+		"*/*;q=0.1, text/plain;q=0.5":                    "text/plain",
+		"application/*, application/json;q=0":            "application/xml",
+		"APPLICATION/XML;Q=0.9, */*;q=0.1":               "application/xml",
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", accept)
+
+		if enc := Negotiate(r, encs); enc == nil || enc.ContentType() != want {
+			t.Errorf("%q: expected %s, got %v", accept, want, enc)
+		}
+	}
+}
+
+func TestNegotiateNotAcceptable(t *testing.T) {
+	for _, accept := range []string{"image/png", "application/json;q=0, text/*;q=0"} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", accept)
+
+		if enc := Negotiate(r, []Encoder{JSONEncoder, TextEncoder}); enc != nil {
+			t.Errorf("%q: expected no encoder, got %s", accept, enc.ContentType())
+		}
+	}
+}
+
+func TestRenderNotAcceptable(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "image/png")
+	w := httptest.NewRecorder()
+
+	Render(w, r, http.StatusOK, map[string]int{"a": 1})
+
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("expected 406, got %d", w.Code)
+	}
+	if v := w.Header().Get("Vary"); v != "Accept" {
+		t.Errorf("expected Vary Accept, got %q", v)
+	}
+}
+
+func TestRenderMsgpack(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "application/msgpack")
+	w := httptest.NewRecorder()
+
+	Render(w, r, http.StatusCreated, map[string]int{"a": 1})
+
+	if w.Code != http.StatusCreated || w.Header().Get("Content-Type") != "application/msgpack" {
+		t.Errorf("unexpected response %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if got := w.Body.String(); got != "\x81\xa1a\x01" {
+		t.Errorf("unexpected body %q", got)
+	}
+}
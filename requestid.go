@@ -0,0 +1,161 @@
+package httpsrv
+
+import (
+	"context"
+	"crypto/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jonasi/ctxlog"
+	uuid "github.com/satori/go.uuid"
+)
+
+// RequestIDHeader is the default header request ids are read from
+// and written to
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID is a Middleware that tags each request with an id using
+// the defaults of RequestIDConf
+var RequestID = RequestIDConf{}.Middleware()
+
+// RequestIDConf configures the request id middleware
+type RequestIDConf struct {
+	// Header defaults to RequestIDHeader
+	Header string
+	// Generate defaults to NewUUID
+	Generate func() string
+	// IgnoreIncoming always generates a new id rather than accepting
+	// one sent by the client
+	IgnoreIncoming bool
+}
+
+// Middleware returns a Middleware that accepts the request id sent
+// by the client or generates a new one. The id is echoed in the
+// response header, stored on the request context and added to the
+// ctxlog fields as request_id.
+func (c RequestIDConf) Middleware() Middleware {
+	header := c.Header
+	if header == "" {
+		header = RequestIDHeader
+	}
+
+	gen := c.Generate
+	if gen == nil {
+		gen = NewUUID
+	}
+
+	return MiddlewareFunc("request_id", func(method, path string, h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(header)
+			if c.IgnoreIncoming || !validRequestID(id) {
+				id = gen()
+				r.Header.Set(header, id)
+			}
+
+			w.Header().Set(header, id)
+
+			ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+			ctx = ctxlog.WithKV(ctx, "request_id", id)
+
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+}
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the request id stored by the
+// request id middleware
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID guards against oversized ids and ids that could
+// be used to inject content into logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// NewUUID returns a random UUID
+func NewUUID() string {
+	return uuid.NewV4().String()
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulidState is the last ULID generated, so ids generated within the
+// same millisecond are monotonic
+var ulidState struct {
+	sync.Mutex
+	ms   uint64
+	last [16]byte
+}
+
+// NewULID returns a random ULID, a lexicographically sortable id
+// made of a millisecond timestamp and 80 random bits. Ids generated
+// within the same millisecond increment the random bits of the
+// previous id, so they sort in the order they were generated.
+func NewULID() string {
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+
+	ulidState.Lock()
+	b := ulidState.last
+	if ms > ulidState.ms {
+		ulidState.ms = ms
+		_, _ = rand.Read(b[6:])
+	} else if !increment(b[6:]) {
+		// the random bits overflowed, so borrow the next millisecond
+		ulidState.ms++
+		_, _ = rand.Read(b[6:])
+	}
+
+	ms = ulidState.ms
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+	ulidState.last = b
+	ulidState.Unlock()
+
+	// 128 bits encoded as 26 base32 characters, most significant first
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[b[15]&0x1f]
+		shiftRight5(&b)
+	}
+
+	return string(out[:])
+}
+
+// increment adds one to the big endian number b, reporting false if
+// it overflowed
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func shiftRight5(b *[16]byte) {
+	var carry byte
+	for i := 0; i < len(b); i++ {
+		next := b[i] << 3
+		b[i] = b[i]>>5 | carry
+		carry = next
+	}
+}
@@ -0,0 +1,114 @@
+package httpsrv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewULIDFormat(t *testing.T) {
+	before := time.Now().Add(-time.Millisecond)
+	id := NewULID()
+
+	if len(id) != 26 || id[0] > '7' {
+		t.Fatalf("unexpected ULID %q", id)
+	}
+
+	var ms int64
+	for i, c := range id {
+		j := strings.IndexRune(crockford, c)
+		if j == -1 {
+			t.Fatalf("invalid character %q in %q", c, id)
+		}
+		// the first 10 characters are the 48 bit timestamp
+		if i < 10 {
+			ms = ms<<5 | int64(j)
+		}
+	}
+
+	if ts := time.Unix(0, ms*int64(time.Millisecond)); ts.Before(before) || ts.After(time.Now()) {
+		t.Errorf("unexpected timestamp %s", ts)
+	}
+}
+
+func TestNewULIDMonotonic(t *testing.T) {
+	prev := NewULID()
+	for i := 0; i < 10000; i++ {
+		id := NewULID()
+		if id <= prev {
+			t.Fatalf("%s generated after %s", id, prev)
+		}
+		prev = id
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	b := []byte{0x00, 0xff, 0xff}
+	if !increment(b) || b[0] != 1 || b[1] != 0 || b[2] != 0 {
+		t.Errorf("unexpected increment %x", b)
+	}
+
+	b = []byte{0xff, 0xff}
+	if increment(b) {
+		t.Error("expected overflow")
+	}
+}
+
+// serveRequestID serves a request with the incoming id through mw and
+// returns the id seen by the handler and the response
+func serveRequestID(mw Middleware, header, incoming string) (string, *httptest.ResponseRecorder) {
+	var (
+		seen string
+		h    = mw.Handler("GET", "/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = RequestIDFromContext(r.Context())
+		}))
+		r = httptest.NewRequest("GET", "/", nil)
+		w = httptest.NewRecorder()
+	)
+
+	if incoming != "" {
+		r.Header.Set(header, incoming)
+	}
+	h.ServeHTTP(w, r)
+
+	return seen, w
+}
+
+func TestRequestIDIncoming(t *testing.T) {
+	for incoming, honoured := range map[string]bool{
+		"abc-123":                true,
+		"":                       false,
+		"with space":             false,
+		"line\nbreak":            false,
+		"ünicode":                false,
+		strings.Repeat("a", 128): true,
+		strings.Repeat("a", 129): false,
+	} {
+		id, w := serveRequestID(RequestID, RequestIDHeader, incoming)
+
+		if id == "" || w.Header().Get(RequestIDHeader) != id {
+			t.Errorf("%q: expected the id %q in the response, got %q", incoming, id, w.Header().Get(RequestIDHeader))
+		}
+		if (id == incoming) != honoured {
+			t.Errorf("%q: expected honoured=%v, got id %q", incoming, honoured, id)
+		}
+	}
+}
+
+func TestRequestIDConf(t *testing.T) {
+	mw := RequestIDConf{
+		Header:         "X-Trace",
+		Generate:       func() string { return "generated" },
+		IgnoreIncoming: true,
+	}.Middleware()
+
+	id, w := serveRequestID(mw, "X-Trace", "abc-123")
+	if id != "generated" || w.Header().Get("X-Trace") != "generated" {
+		t.Errorf("expected a generated id, got %q and %q", id, w.Header().Get("X-Trace"))
+	}
+	if w.Header().Get(RequestIDHeader) != "" {
+		t.Error("default header written with a custom header")
+	}
+}
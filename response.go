@@ -0,0 +1,102 @@
+package httpsrv
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+)
+
+// responseWriter wraps an http.ResponseWriter and records the status
+// and size of the response for middleware. Flush, Hijack, Push and
+// ReadFrom are passed through when the wrapped writer supports them.
+type responseWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func wrapResponseWriter(w http.ResponseWriter) *responseWriter {
+	if rw, ok := w.(*responseWriter); ok {
+		return rw
+	}
+
+	return &responseWriter{ResponseWriter: w}
+}
+
+// Status returns the status written, or 0 if nothing has been written
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+// Written returns the number of body bytes written
+func (w *responseWriter) Written() int64 {
+	return w.written
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+// ReadFrom lets io.Copy use the wrapped writer's ReadFrom, e.g. to
+// sendfile from an *os.File
+func (w *responseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err := rf.ReadFrom(r)
+		w.written += n
+		return n, err
+	}
+
+	// hide ReadFrom so io.Copy does not call back into it
+	return io.Copy(struct{ io.Writer }{w}, r)
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+var errHijackNotSupported = errors.New("hijack not supported")
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+
+	return nil, nil, errHijackNotSupported
+}
+
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+
+	return http.ErrNotSupported
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,64 @@
+package httpsrv
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// readerFromRecorder is a ResponseRecorder that implements
+// io.ReaderFrom, like the net/http response writer
+type readerFromRecorder struct {
+	*httptest.ResponseRecorder
+	calls int
+}
+
+func (r *readerFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	r.calls++
+	return io.Copy(r.ResponseRecorder, src)
+}
+
+func TestResponseWriterReadFrom(t *testing.T) {
+	var (
+		rec = &readerFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+		w   = wrapResponseWriter(rec)
+	)
+
+	// hide WriteTo so io.Copy uses ReadFrom
+	n, err := io.Copy(w, struct{ io.Reader }{strings.NewReader("hello")})
+	if err != nil || n != 5 {
+		t.Fatalf("unexpected copy result %d, %v", n, err)
+	}
+
+	if rec.calls != 1 {
+		t.Errorf("expected ReadFrom to be forwarded once, got %d", rec.calls)
+	}
+	if w.Status() != http.StatusOK || w.Written() != 5 {
+		t.Errorf("unexpected status %d and size %d", w.Status(), w.Written())
+	}
+	if rec.Body.String() != "hello" {
+		t.Errorf("unexpected body %q", rec.Body)
+	}
+}
+
+func TestResponseWriterReadFromFallback(t *testing.T) {
+	var (
+		rec = httptest.NewRecorder()
+		w   = wrapResponseWriter(rec)
+	)
+
+	w.WriteHeader(http.StatusCreated)
+	n, err := w.ReadFrom(strings.NewReader("hello"))
+	if err != nil || n != 5 {
+		t.Fatalf("unexpected copy result %d, %v", n, err)
+	}
+
+	if w.Status() != http.StatusCreated || w.Written() != 5 {
+		t.Errorf("unexpected status %d and size %d", w.Status(), w.Written())
+	}
+	if rec.Code != http.StatusCreated || rec.Body.String() != "hello" {
+		t.Errorf("unexpected response %d %q", rec.Code, rec.Body)
+	}
+}
@@ -1,6 +1,7 @@
 package httpsrv
 
 import (
+	"context"
 	"net/http"
 )
 
@@ -11,6 +12,57 @@ type Route struct {
 	Path       string
 	Handler    http.Handler
 	Middleware []Middleware
+	Doc        *RouteDoc
+	// Priority controls how the route is treated when the server is
+	// shedding load
+	Priority Priority
+}
+
+// Priority classifies routes for load shedding
+type Priority int
+
+const (
+	// PriorityNormal routes wait in the queue when at the limit
+	PriorityNormal Priority = iota
+	// PriorityLow routes are shed immediately when at the limit
+	PriorityLow
+	// PriorityCritical routes, e.g. health checks and admin routes,
+	// bypass concurrency limits and load shedding
+	PriorityCritical
+)
+
+type routeKey struct{}
+
+// RouteFromContext returns the route handling the request ctx belongs
+// to, or nil if the request was not matched to a route
+func RouteFromContext(ctx context.Context) *Route {
+	r, _ := ctx.Value(routeKey{}).(*Route)
+	return r
+}
+
+// withRoute makes rt available to every middleware run for the route
+func withRoute(rt *Route, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), routeKey{}, rt)))
+	})
+}
+
+// RouteDoc is optional metadata describing a Route in generated
+// OpenAPI documents
+type RouteDoc struct {
+	Summary     string
+	Description string
+	OperationID string
+	Tags        []string
+	Deprecated  bool
+	// Request and Response are values whose types describe the request
+	// and response. They default to the types of a TypedHandler.
+	Request  interface{}
+	Response interface{}
+	// Params describes parameters by name
+	Params map[string]string
+	// Hidden excludes the route from generated documents
+	Hidden bool
 }
 
 type routes []*Route
@@ -21,9 +21,11 @@ func New(addr string) *Server {
 	s := &Server{
 		router: mux,
 		addr:   []string{addr},
-		server: &http.Server{
-			Handler: mux,
-		},
+	}
+
+	s.server = &http.Server{
+		Handler:   mux,
+		ConnState: s.trackConn,
 	}
 
 	s.Service = svc.WrapBlocking(s.start, s.stop)
@@ -41,7 +43,10 @@ type Server struct {
 	routes             routes
 	notFound           http.Handler
 	notFoundMiddleware []Middleware
+	encoders           []Encoder
 	started            int32
+	listeners          int64
+	conns              int64
 }
 
 // AddListenAddr adds a new address to listen to when the server starts
@@ -69,6 +74,23 @@ func (s *Server) Lookup(method, path string) *Route {
 	return nil
 }
 
+// methods returns the methods registered for the route path
+func (s *Server) methods(path string) []string {
+	methods := []string{}
+	for _, r := range s.routes {
+		if r.Path != path {
+			continue
+		}
+
+		if r.Method == "*" {
+			return allMethods
+		}
+		methods = append(methods, r.Method)
+	}
+
+	return methods
+}
+
 // Handle registers the provided route with the router
 func (s *Server) Handle(rts ...*Route) {
 	if atomic.LoadInt32(&s.started) == 1 {
@@ -106,11 +128,41 @@ func (s *Server) AddMiddleware(mw ...Middleware) {
 	s.middleware = append(s.middleware, mw...)
 }
 
+// AddEncoder registers encoders used by Render for requests handled by
+// the server. The first encoder registered is the default when the
+// request accepts any media type.
+func (s *Server) AddEncoder(enc ...Encoder) {
+	if atomic.LoadInt32(&s.started) == 1 {
+		panic("Attempting to register encoders after the server has started")
+	}
+
+	s.encoders = append(s.encoders, enc...)
+}
+
+// Listeners returns the number of addresses the server is listening on
+func (s *Server) Listeners() int64 {
+	return atomic.LoadInt64(&s.listeners)
+}
+
+// OpenConns returns the number of open client connections
+func (s *Server) OpenConns() int64 {
+	return atomic.LoadInt64(&s.conns)
+}
+
+func (s *Server) trackConn(_ net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		atomic.AddInt64(&s.conns, 1)
+	case http.StateHijacked, http.StateClosed:
+		atomic.AddInt64(&s.conns, -1)
+	}
+}
+
 // Start starts the server
 func (s *Server) start(ctx context.Context) error {
 	atomic.StoreInt32(&s.started, 1)
 	s.server.BaseContext = func(_ net.Listener) context.Context {
-		return ctx
+		return context.WithValue(ctx, serverKey{}, s)
 	}
 
 	ctxlog.Info(ctx, "Starting server")
@@ -154,6 +206,7 @@ func (s *Server) initRoutes(ctx context.Context) {
 	sort.Sort(s.routes)
 	for _, r := range s.routes {
 		h, mws := s.applyMiddleware(r.Method, r.Path, r.Handler, r.Middleware)
+		h = withRoute(r, h)
 
 		if r.Method == "*" {
 			ctxlog.Infof(ctx, "Handling all methods for path: %s with middleware: %v", r.Path, mws)
@@ -208,7 +261,9 @@ func (s *Server) initListeners(ctx context.Context) error {
 		serveCh[i] = make(chan struct{})
 		go func(l net.Listener, i int) {
 			ctxlog.Infof(ctx, "Server listening at %s", l.Addr())
+			atomic.AddInt64(&s.listeners, 1)
 			err := s.server.Serve(l)
+			atomic.AddInt64(&s.listeners, -1)
 
 			// normal shutdown
 			if err == http.ErrServerClosed {
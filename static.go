@@ -0,0 +1,327 @@
+package httpsrv
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// precompressedExts maps encodings to the extension of precompressed
+// siblings, e.g. app.js.br
+var precompressedExts = map[string]string{
+	"br":   ".br",
+	"zstd": ".zst",
+	"gzip": ".gz",
+}
+
+// AssetsConf configures how static assets are served
+type AssetsConf struct {
+	// Precompressed are the encodings of precompressed siblings served
+	// when the client accepts them, in order of preference. Defaults to
+	// br, zstd, gzip.
+	Precompressed []string
+	// Hashed reports whether a file name contains a content hash so the
+	// file can be cached forever. Defaults to IsHashedName.
+	Hashed func(name string) bool
+	// Listing enables directory listings
+	Listing bool
+}
+
+// AssetsHandler returns an http.Handler serving files from fs with the
+// default AssetsConf
+func AssetsHandler(fs http.FileSystem) http.Handler {
+	return AssetsConf{}.Handler(fs)
+}
+
+// Handler returns an http.Handler serving files from fs. Hashed files
+// are served as immutable for a year and other files must be
+// revalidated using their strong ETag.
+func (c AssetsConf) Handler(fs http.FileSystem) http.Handler {
+	if c.Precompressed == nil {
+		c.Precompressed = []string{"br", "zstd", "gzip"}
+	}
+	if c.Hashed == nil {
+		c.Hashed = IsHashedName
+	}
+
+	var (
+		listing = http.FileServer(fs)
+		etags   = &etagCache{}
+	)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + r.URL.Path)
+
+		f, err := fs.Open(name)
+		if err != nil {
+			serveFileError(w, err)
+			return
+		}
+		defer f.Close()
+
+		fi, err := f.Stat()
+		if err != nil {
+			serveFileError(w, err)
+			return
+		}
+
+		if fi.IsDir() {
+			if c.Listing {
+				listing.ServeHTTP(w, r)
+				return
+			}
+
+			if r.URL.Path != "" && !strings.HasSuffix(r.URL.Path, "/") {
+				http.Redirect(w, r, path.Base(r.URL.Path)+"/", http.StatusMovedPermanently)
+				return
+			}
+
+			name = path.Join(name, "index.html")
+			if f, err = fs.Open(name); err != nil {
+				serveFileError(w, err)
+				return
+			}
+			defer f.Close()
+
+			if fi, err = f.Stat(); err != nil || fi.IsDir() {
+				http.NotFound(w, r)
+				return
+			}
+		}
+
+		h := w.Header()
+		if ct, ok := f.(contentTyper); ok && ct.ContentType() != "" {
+			h.Set("Content-Type", ct.ContentType())
+		} else if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+			h.Set("Content-Type", ctype)
+		} else {
+			var buf [512]byte
+			n, _ := io.ReadFull(f, buf[:])
+			h.Set("Content-Type", http.DetectContentType(buf[:n]))
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				serveFileError(w, err)
+				return
+			}
+		}
+
+		if c.Hashed(name) {
+			h.Set("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			h.Set("Cache-Control", "no-cache")
+		}
+
+		served := name
+		if cf, cfi, enc := c.precompressed(w, r, fs, name); cf != nil {
+			defer cf.Close()
+			f, fi = cf, cfi
+			served += precompressedExts[enc]
+			h.Set("Content-Encoding", enc)
+		}
+
+		etag, err := etags.get(served, f, fi)
+		if err != nil {
+			serveFileError(w, err)
+			return
+		}
+		h.Set("ETag", etag)
+
+		http.ServeContent(w, r, name, fi.ModTime(), f)
+	})
+}
+
+// precompressed opens the best precompressed sibling of name accepted
+// by r, if any, and varies the response on Accept-Encoding
+func (c AssetsConf) precompressed(w http.ResponseWriter, r *http.Request, fs http.FileSystem, name string) (http.File, os.FileInfo, string) {
+	var (
+		files = map[string]http.File{}
+		infos = map[string]os.FileInfo{}
+		avail = []string{}
+	)
+
+	for _, enc := range c.Precompressed {
+		ext, ok := precompressedExts[enc]
+		if !ok {
+			continue
+		}
+
+		f, err := fs.Open(name + ext)
+		if err != nil {
+			continue
+		}
+
+		fi, err := f.Stat()
+		if err != nil || fi.IsDir() {
+			f.Close()
+			continue
+		}
+
+		files[enc], infos[enc] = f, fi
+		avail = append(avail, enc)
+	}
+
+	if len(avail) == 0 {
+		return nil, nil, ""
+	}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+	enc := negotiateEncoding(r.Header.Get("Accept-Encoding"), avail)
+	for e, f := range files {
+		if e != enc {
+			f.Close()
+		}
+	}
+
+	return files[enc], infos[enc], enc
+}
+
+// contentTyper is implemented by files that know their content type
+type contentTyper interface {
+	ContentType() string
+}
+
+// etagger is implemented by files that know their own ETag
+type etagger interface {
+	ETag() string
+}
+
+// fileETag returns a strong ETag of the contents of f
+func fileETag(f http.File) (string, error) {
+	if e, ok := f.(etagger); ok {
+		return e.ETag(), nil
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	return hashETag(hash.Sum(nil)), nil
+}
+
+// etagCache holds the ETags of files by name so they are only hashed
+// again once their size or modification time changes
+type etagCache struct {
+	m sync.Map
+}
+
+type etagEntry struct {
+	size    int64
+	modTime time.Time
+	etag    string
+}
+
+func (c *etagCache) get(name string, f http.File, fi os.FileInfo) (string, error) {
+	// generated files have no modification time to detect changes by
+	if fi.ModTime().IsZero() {
+		return fileETag(f)
+	}
+
+	if v, ok := c.m.Load(name); ok {
+		e := v.(etagEntry)
+		if e.size == fi.Size() && e.modTime.Equal(fi.ModTime()) {
+			return e.etag, nil
+		}
+	}
+
+	etag, err := fileETag(f)
+	if err != nil {
+		return "", err
+	}
+
+	c.m.Store(name, etagEntry{size: fi.Size(), modTime: fi.ModTime(), etag: etag})
+	return etag, nil
+}
+
+// hashETag formats a content hash as a strong ETag
+func hashETag(sum []byte) string {
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+func serveFileError(w http.ResponseWriter, err error) {
+	switch {
+	case os.IsNotExist(err):
+		http.Error(w, "404 page not found", http.StatusNotFound)
+	case os.IsPermission(err):
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+	default:
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// IsHashedName reports whether the file name contains a content hash,
+// e.g. app.3f9a1c0d.js or index-B4x-_kPd.js. A hash follows a ., - or
+// ~ and is at least 8 characters with both letters and digits, either
+// hex or base64url with both upper and lower case letters, so names
+// such as invoice-123456.pdf or report.20240101.csv are not matched.
+func IsHashedName(name string) bool {
+	base := path.Base(name)
+
+	// strip the extension
+	i := strings.LastIndexByte(base, '.')
+	if i <= 0 {
+		return false
+	}
+	stem := base[:i]
+
+	for j, r := range stem {
+		if r != '.' && r != '-' && r != '~' {
+			continue
+		}
+
+		hash := stem[j+1:]
+		if k := strings.IndexByte(hash, '.'); k != -1 {
+			hash = hash[:k]
+		}
+		if isHash(hash) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isHash(s string) bool {
+	if len(s) < 8 {
+		return false
+	}
+
+	var upper, lower, digit, sep, nonHex bool
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digit = true
+		case r >= 'a' && r <= 'z':
+			lower = true
+			nonHex = nonHex || r > 'f'
+		case r >= 'A' && r <= 'Z':
+			upper = true
+			nonHex = nonHex || r > 'F'
+		case r == '-', r == '_':
+			sep = true
+		default:
+			return false
+		}
+	}
+
+	if !digit || !(upper || lower) {
+		return false
+	}
+
+	// hex, e.g. 3f9a1c0d
+	if !sep && !nonHex && !(upper && lower) {
+		return true
+	}
+
+	// base64url, e.g. B4x-_kPd
+	return upper && lower
+}
@@ -0,0 +1,38 @@
+package httpsrv
+
+import "testing"
+
+func TestIsHashedName(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		hashed bool
+	}{
+		// hex
+		{"/js/app.3f9a1c0d.js", true},
+		{"main.a1b2c3d4e5f60718.chunk.js", true},
+		{"style-0123ABCD.css", true},
+		{"app~7e8f9a0b.js", true},
+		// base64url
+		{"index-BxY3k2Zd.js", true},
+		{"/assets/index-B4x-_kPd.js", true},
+		{"chunk-vendors-Dk2p_S9q.js", true},
+		{"logo.Ab_9-xYz.svg", true},
+		// not hashes
+		{"invoice-123456.pdf", false},
+		{"report.20240101.csv", false},
+		{"IMG-20240101-WA0001.jpg", false},
+		{"icon-512x512px.png", false},
+		{"font-awesome-4-7.css", false},
+		{"jquery-3.6.0.min.js", false},
+		{"react-dom.production.min.js", false},
+		{"app.3f9a1c.js", false},
+		{"index.html", false},
+		{"a1b2c3d4e5.js", false},
+		{".a1b2c3d4e5", false},
+		{"README", false},
+	} {
+		if got := IsHashedName(tt.name); got != tt.hashed {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.hashed, got)
+		}
+	}
+}
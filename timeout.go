@@ -0,0 +1,142 @@
+package httpsrv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/jonasi/ctxlog"
+)
+
+// ErrTimeout is written with a 503 when a handler exceeds its timeout
+var ErrTimeout = errors.New("request timed out")
+
+// Timeout returns a Middleware that runs handlers with a context
+// deadline of d. If the handler has not finished by the deadline a 503
+// is written with WriteError and any further writes by the handler
+// fail with http.ErrHandlerTimeout.
+//
+// Responses are buffered until the handler returns, so streaming
+// handlers should opt out with SkipMiddleware(Timeout(0)). A Timeout
+// registered on a route replaces any Timeout registered globally.
+func Timeout(d time.Duration) Middleware {
+	return replacingMiddleware("timeout", func(method, path string, h http.Handler) http.Handler {
+		return timeoutHandler(d, h)
+	})
+}
+
+func timeoutHandler(d time.Duration, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+
+		var (
+			r2      = r.WithContext(ctx)
+			tw      = &timeoutWriter{h: http.Header{}}
+			done    = make(chan struct{})
+			panicCh = make(chan interface{}, 1)
+		)
+
+		go func() {
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+
+				// nobody is left to re-panic once the request timed out
+				if tw.timedOut {
+					ctxlog.Errorf(r.Context(), "Panic after timeout: %v\n%s", v, debug.Stack())
+					return
+				}
+				panicCh <- v
+			}()
+
+			h.ServeHTTP(tw, r2)
+			close(done)
+		}()
+
+		select {
+		case v := <-panicCh:
+			// re-panic in the serving goroutine so Recover and
+			// net/http can handle it
+			panic(v)
+		case <-done:
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+
+			dst := w.Header()
+			for k, vv := range tw.h {
+				dst[k] = vv
+			}
+
+			if tw.status == 0 {
+				tw.status = http.StatusOK
+			}
+
+			w.WriteHeader(tw.status)
+			_, _ = tw.buf.WriteTo(w)
+		case <-ctx.Done():
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+
+			tw.timedOut = true
+
+			// the handler panicked before the timeout was handled
+			select {
+			case v := <-panicCh:
+				panic(v)
+			default:
+			}
+
+			if ctx.Err() == context.DeadlineExceeded {
+				WriteError(w, r, NewStatusError(http.StatusServiceUnavailable, ErrTimeout))
+			}
+		}
+	})
+}
+
+// timeoutWriter buffers a response so it can be discarded if the
+// handler times out
+type timeoutWriter struct {
+	mu       sync.Mutex
+	h        http.Header
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+
+	return tw.buf.Write(b)
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut || tw.status != 0 {
+		return
+	}
+	tw.status = status
+}
@@ -0,0 +1,491 @@
+package httpsrv
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonasi/ctxlog"
+)
+
+// TraceID identifies a trace, as defined by W3C Trace Context
+type TraceID [16]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+
+// IsValid reports whether t is non-zero
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+
+// IsValid reports whether s is non-zero
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// Span is a traced unit of work, one per request for spans started by
+// the tracing middleware
+type Span struct {
+	Name       string
+	TraceID    TraceID
+	SpanID     SpanID
+	ParentID   SpanID
+	TraceState string
+	Sampled    bool
+	Start      time.Time
+	End        time.Time
+	Status     int
+	Err        error
+
+	mu    sync.Mutex
+	attrs map[string]interface{}
+}
+
+// SetAttribute records k=v on s
+func (s *Span) SetAttribute(k string, v interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.attrs == nil {
+		s.attrs = map[string]interface{}{}
+	}
+	s.attrs[k] = v
+}
+
+// Attributes returns a copy of the attributes recorded on s
+func (s *Span) Attributes() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string]interface{}, len(s.attrs))
+	for k, v := range s.attrs {
+		out[k] = v
+	}
+	return out
+}
+
+// RecordError marks s as failed with err
+func (s *Span) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Err = err
+}
+
+// Traceparent returns the W3C traceparent header value for s
+func (s *Span) Traceparent() string {
+	flags := "00"
+	if s.Sampled {
+		flags = "01"
+	}
+
+	return "00-" + s.TraceID.String() + "-" + s.SpanID.String() + "-" + flags
+}
+
+type spanKey struct{}
+
+// SpanFromContext returns the span started for the request ctx
+// belongs to, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// InjectTraceContext sets the traceparent and tracestate headers on h
+// so outgoing requests continue the trace of the span in ctx
+func InjectTraceContext(ctx context.Context, h http.Header) {
+	s := SpanFromContext(ctx)
+	if s == nil {
+		return
+	}
+
+	h.Set("traceparent", s.Traceparent())
+	if s.TraceState != "" {
+		h.Set("tracestate", s.TraceState)
+	}
+}
+
+// parseTraceparent parses a version 00 traceparent header
+func parseTraceparent(v string) (TraceID, SpanID, bool, bool) {
+	var (
+		tid   TraceID
+		sid   SpanID
+		parts = strings.Split(strings.TrimSpace(v), "-")
+	)
+
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return tid, sid, false, false
+	}
+
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return tid, sid, false, false
+	}
+
+	if _, err := hex.Decode(tid[:], []byte(parts[1])); err != nil || !tid.IsValid() {
+		return tid, sid, false, false
+	}
+	if _, err := hex.Decode(sid[:], []byte(parts[2])); err != nil || !sid.IsValid() {
+		return tid, sid, false, false
+	}
+
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return tid, sid, false, false
+	}
+
+	return tid, sid, flags&1 == 1, true
+}
+
+// SpanExporter receives finished spans
+type SpanExporter interface {
+	ExportSpans(ctx context.Context, spans []*Span) error
+}
+
+// Tracer starts a span for each request and hands sampled spans to
+// its Exporter when the request finishes
+type Tracer struct {
+	Exporter SpanExporter
+}
+
+// Middleware returns a Middleware that continues the trace found in the
+// traceparent header, or starts a new one, with a span named after the
+// route. The trace and span ids are added to the ctxlog fields and the
+// structured access log, and the traceparent of the span is written
+// to the response.
+func (t *Tracer) Middleware() Middleware {
+	return MiddlewareFunc("tracing", func(method, path string, h http.Handler) http.Handler {
+		name := method + " " + path
+		if path == "" {
+			name = "not_found"
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			span := &Span{Name: name, Start: time.Now(), Sampled: true}
+
+			if tid, pid, sampled, ok := parseTraceparent(r.Header.Get("traceparent")); ok {
+				span.TraceID, span.ParentID, span.Sampled = tid, pid, sampled
+				span.TraceState = r.Header.Get("tracestate")
+			} else {
+				_, _ = rand.Read(span.TraceID[:])
+			}
+			_, _ = rand.Read(span.SpanID[:])
+
+			span.SetAttribute("http.method", r.Method)
+			span.SetAttribute("http.route", path)
+			span.SetAttribute("http.target", r.URL.RequestURI())
+			span.SetAttribute("net.protocol", protocol(r))
+
+			ctx := context.WithValue(r.Context(), spanKey{}, span)
+			ctx = ctxlog.WithKV(ctx, "trace_id", span.TraceID.String())
+			ctx = ctxlog.WithKV(ctx, "span_id", span.SpanID.String())
+			AddAccessLogField(ctx, "trace_id", span.TraceID.String())
+			AddAccessLogField(ctx, "span_id", span.SpanID.String())
+
+			w.Header().Set("traceparent", span.Traceparent())
+
+			rw := wrapResponseWriter(w)
+			defer func() {
+				span.End = time.Now()
+				span.Status = rw.Status()
+				if span.Status == 0 {
+					span.Status = http.StatusOK
+				}
+				span.SetAttribute("http.status_code", span.Status)
+
+				if v := recover(); v != nil {
+					span.RecordError(fmt.Errorf("panic: %v", v))
+					t.export(ctx, span)
+					panic(v)
+				}
+
+				t.export(ctx, span)
+			}()
+
+			h.ServeHTTP(rw, r.WithContext(ctx))
+		})
+	})
+}
+
+func (t *Tracer) export(ctx context.Context, s *Span) {
+	if t.Exporter == nil || !s.Sampled {
+		return
+	}
+
+	if err := t.Exporter.ExportSpans(ctx, []*Span{s}); err != nil {
+		ctxlog.Errorf(ctx, "Error exporting span: %s", err)
+	}
+}
+
+// InMemoryExporter keeps exported spans in memory, e.g. for tests
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// ExportSpans satisfies SpanExporter
+func (e *InMemoryExporter) ExportSpans(_ context.Context, spans []*Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+// Spans returns the spans exported so far
+func (e *InMemoryExporter) Spans() []*Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*Span{}, e.spans...)
+}
+
+// Reset drops all exported spans
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+// OTLPExporter sends spans as OTLP/HTTP json to a collector, e.g.
+// http://localhost:4318/v1/traces. Spans are buffered and sent in
+// batches of BatchSize, when Flush is called and, once Start is called,
+// every FlushInterval. Shutdown should be called before exiting to send
+// the remaining spans.
+type OTLPExporter struct {
+	Endpoint    string
+	ServiceName string
+	Headers     map[string]string
+	BatchSize   int
+	// FlushInterval is how often buffered spans are sent regardless of
+	// BatchSize. Defaults to 5s.
+	FlushInterval time.Duration
+	Client        *http.Client
+
+	mu      sync.Mutex
+	buf     []*Span
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// Start flushes the buffered spans every FlushInterval until ctx is
+// done or Shutdown is called. ctx should live as long as the server,
+// not a single request. Calling Start while already started is a no-op.
+func (e *OTLPExporter) Start(ctx context.Context) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.stop != nil {
+		return
+	}
+
+	e.stop, e.stopped = make(chan struct{}), make(chan struct{})
+	go e.flushLoop(ctx, e.stop, e.stopped)
+}
+
+// ExportSpans satisfies SpanExporter
+func (e *OTLPExporter) ExportSpans(ctx context.Context, spans []*Span) error {
+	size := e.BatchSize
+	if size <= 0 {
+		size = 512
+	}
+
+	e.mu.Lock()
+	e.buf = append(e.buf, spans...)
+	full := len(e.buf) >= size
+	e.mu.Unlock()
+
+	if full {
+		// the request context is done once the response is sent
+		go func() {
+			if err := e.Flush(context.Background()); err != nil {
+				ctxlog.Errorf(ctx, "Error flushing spans to %s: %s", e.Endpoint, err)
+			}
+		}()
+	}
+
+	return nil
+}
+
+// flushLoop flushes the buffered spans every FlushInterval until ctx
+// is done or stop is closed
+func (e *OTLPExporter) flushLoop(ctx context.Context, stop <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+
+	interval := e.FlushInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := e.Flush(context.Background()); err != nil {
+				ctxlog.Errorf(ctx, "Error flushing spans to %s: %s", e.Endpoint, err)
+			}
+		}
+	}
+}
+
+// Shutdown stops the periodic flush and sends the remaining spans.
+// Spans exported afterwards are only sent by Flush or once BatchSize
+// is reached, until Start is called again.
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	stop, stopped := e.stop, e.stopped
+	e.stop, e.stopped = nil, nil
+	e.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return e.Flush(ctx)
+}
+
+// Flush sends all buffered spans to the collector
+func (e *OTLPExporter) Flush(ctx context.Context) error {
+	e.mu.Lock()
+	spans := e.buf
+	e.buf = nil
+	e.mu.Unlock()
+
+	if len(spans) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(otlpPayload(e.ServiceName, spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("otlp export failed with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// otlp span kind and status codes
+const (
+	otlpKindServer  = 2
+	otlpStatusOK    = 1
+	otlpStatusError = 2
+)
+
+func otlpPayload(service string, spans []*Span) map[string]interface{} {
+	out := make([]interface{}, len(spans))
+	for i, s := range spans {
+		var (
+			attrs  []interface{}
+			status = map[string]interface{}{"code": otlpStatusOK}
+			a      = s.Attributes()
+		)
+
+		for _, k := range sortedKeys(a) {
+			attrs = append(attrs, map[string]interface{}{"key": k, "value": otlpValue(a[k])})
+		}
+
+		s.mu.Lock()
+		err := s.Err
+		s.mu.Unlock()
+
+		switch {
+		case err != nil:
+			status = map[string]interface{}{"code": otlpStatusError, "message": err.Error()}
+		case s.Status >= 500:
+			status = map[string]interface{}{"code": otlpStatusError}
+		}
+
+		span := map[string]interface{}{
+			"traceId":           s.TraceID.String(),
+			"spanId":            s.SpanID.String(),
+			"name":              s.Name,
+			"kind":              otlpKindServer,
+			"startTimeUnixNano": strconv.FormatInt(s.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.End.UnixNano(), 10),
+			"attributes":        attrs,
+			"status":            status,
+		}
+
+		if s.ParentID.IsValid() {
+			span["parentSpanId"] = s.ParentID.String()
+		}
+		if s.TraceState != "" {
+			span["traceState"] = s.TraceState
+		}
+
+		out[i] = span
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []interface{}{
+						map[string]interface{}{"key": "service.name", "value": otlpValue(service)},
+					},
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "github.com/jonasi/httpsrv"},
+						"spans": out,
+					},
+				},
+			},
+		},
+	}
+}
+
+func otlpValue(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case bool:
+		return map[string]interface{}{"boolValue": v}
+	case int:
+		return map[string]interface{}{"intValue": strconv.Itoa(v)}
+	case int64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		return map[string]interface{}{"doubleValue": v}
+	}
+
+	return map[string]interface{}{"stringValue": fmt.Sprint(v)}
+}
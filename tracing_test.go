@@ -0,0 +1,247 @@
+package httpsrv
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTracerMiddleware(t *testing.T) {
+	var (
+		exp = &InMemoryExporter{}
+		tr  = &Tracer{Exporter: exp}
+		h   = tr.Middleware().Handler("GET", "/users/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			SpanFromContext(r.Context()).SetAttribute("user.id", "1")
+			w.WriteHeader(http.StatusTeapot)
+		}))
+	)
+
+	r := httptest.NewRequest("GET", "/users/1", nil)
+	r.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	spans := exp.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+
+	s := spans[0]
+	if s.Name != "GET /users/:id" {
+		t.Errorf("unexpected name %q", s.Name)
+	}
+	if s.TraceID.String() != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("trace id not continued: %s", s.TraceID)
+	}
+	if s.ParentID.String() != "b7ad6b7169203331" {
+		t.Errorf("unexpected parent id %s", s.ParentID)
+	}
+	if s.Status != http.StatusTeapot {
+		t.Errorf("unexpected status %d", s.Status)
+	}
+	if v := s.Attributes()["user.id"]; v != "1" {
+		t.Errorf("handler attribute not recorded: %v", v)
+	}
+	if tp := w.Header().Get("traceparent"); tp != s.Traceparent() {
+		t.Errorf("unexpected traceparent %q", tp)
+	}
+}
+
+func TestTracerMiddlewareUnsampled(t *testing.T) {
+	var (
+		exp = &InMemoryExporter{}
+		h   = (&Tracer{Exporter: exp}).Middleware().Handler("GET", "/", http.NotFoundHandler())
+	)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if n := len(exp.Spans()); n != 0 {
+		t.Fatalf("expected unsampled span to be dropped, got %d", n)
+	}
+}
+
+func TestTracerMiddlewarePanic(t *testing.T) {
+	var (
+		exp = &InMemoryExporter{}
+		h   = (&Tracer{Exporter: exp}).Middleware().Handler("GET", "/", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			panic("boom")
+		}))
+	)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic to be rethrown")
+			}
+		}()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}()
+
+	spans := exp.Spans()
+	if len(spans) != 1 || spans[0].Err == nil {
+		t.Fatalf("expected a failed span, got %v", spans)
+	}
+}
+
+// collector records the spans posted to it
+type collector struct {
+	mu    sync.Mutex
+	spans int
+	got   chan struct{}
+}
+
+func newCollector() (*collector, *httptest.Server) {
+	c := &collector{got: make(chan struct{}, 10)}
+	return c, httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []json.RawMessage `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		c.mu.Lock()
+		for _, rs := range body.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				c.spans += len(ss.Spans)
+			}
+		}
+		c.mu.Unlock()
+		c.got <- struct{}{}
+	}))
+}
+
+func (c *collector) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.spans
+}
+
+func TestOTLPExporterFlushInterval(t *testing.T) {
+	c, srv := newCollector()
+	defer srv.Close()
+
+	exp := &OTLPExporter{Endpoint: srv.URL, FlushInterval: 10 * time.Millisecond}
+	exp.Start(context.Background())
+	defer exp.Shutdown(context.Background())
+
+	// spans exported with a finished request's context are still flushed
+	reqCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := exp.ExportSpans(reqCtx, []*Span{{Name: "a", Sampled: true}}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-c.got:
+	case <-time.After(time.Second):
+		t.Fatal("spans not flushed after FlushInterval")
+	}
+
+	if n := c.count(); n != 1 {
+		t.Fatalf("expected 1 span, got %d", n)
+	}
+}
+
+func TestOTLPExporterRestart(t *testing.T) {
+	c, srv := newCollector()
+	defer srv.Close()
+
+	exp := &OTLPExporter{Endpoint: srv.URL, FlushInterval: 10 * time.Millisecond}
+	exp.Start(context.Background())
+	if err := exp.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	exp.Start(context.Background())
+	defer exp.Shutdown(context.Background())
+
+	_ = exp.ExportSpans(context.Background(), []*Span{{Name: "a", Sampled: true}})
+
+	select {
+	case <-c.got:
+	case <-time.After(time.Second):
+		t.Fatal("spans not flushed after restarting")
+	}
+}
+
+func TestOTLPExporterStartContext(t *testing.T) {
+	c, srv := newCollector()
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	exp := &OTLPExporter{Endpoint: srv.URL, FlushInterval: 10 * time.Millisecond}
+	exp.Start(ctx)
+	cancel()
+
+	// wait for the loop to see the cancellation
+	exp.mu.Lock()
+	stopped := exp.stopped
+	exp.mu.Unlock()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("flush loop still running after its context was cancelled")
+	}
+
+	_ = exp.ExportSpans(context.Background(), []*Span{{Name: "a", Sampled: true}})
+	time.Sleep(50 * time.Millisecond)
+	if n := c.count(); n != 0 {
+		t.Fatalf("expected spans to be buffered, got %d sent", n)
+	}
+
+	if err := exp.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := c.count(); n != 1 {
+		t.Fatalf("expected 1 span after Shutdown, got %d", n)
+	}
+}
+
+func TestOTLPExporterShutdown(t *testing.T) {
+	c, srv := newCollector()
+	defer srv.Close()
+
+	exp := &OTLPExporter{Endpoint: srv.URL, FlushInterval: time.Hour}
+	spans := []*Span{{Name: "a", Sampled: true}, {Name: "b", Sampled: true}}
+	if err := exp.ExportSpans(context.Background(), spans); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := c.count(); n != 0 {
+		t.Fatalf("expected spans to be buffered, got %d sent", n)
+	}
+
+	if err := exp.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := c.count(); n != 2 {
+		t.Fatalf("expected 2 spans after Shutdown, got %d", n)
+	}
+}
+
+func TestOTLPExporterError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	exp := &OTLPExporter{Endpoint: srv.URL, FlushInterval: time.Hour}
+	_ = exp.ExportSpans(context.Background(), []*Span{{Name: "a", Sampled: true}})
+
+	err := exp.Shutdown(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("expected status error, got %v", err)
+	}
+}
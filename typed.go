@@ -0,0 +1,76 @@
+package httpsrv
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+)
+
+// TypedHandler is an http.Handler created with Typed that exposes
+// its request and response types, e.g. for schema generation
+type TypedHandler interface {
+	http.Handler
+	RequestType() reflect.Type
+	ResponseType() reflect.Type
+}
+
+// Typed returns a handler that binds Req from the request, calls fn and
+// renders the returned Resp.
+//
+// Struct request types are populated with Bind, any other type is
+// decoded from the json body. Errors returned from binding or fn are
+// written with WriteError. The response is written with Render and a
+// 200 status, unless Resp implements StatusCoder.
+func Typed[Req, Resp any](fn func(ctx context.Context, req Req) (Resp, error)) TypedHandler {
+	return &typedHandler[Req, Resp]{fn: fn}
+}
+
+type typedHandler[Req, Resp any] struct {
+	fn func(context.Context, Req) (Resp, error)
+}
+
+func (h *typedHandler[Req, Resp]) RequestType() reflect.Type {
+	return reflect.TypeOf((*Req)(nil)).Elem()
+}
+
+func (h *typedHandler[Req, Resp]) ResponseType() reflect.Type {
+	return reflect.TypeOf((*Resp)(nil)).Elem()
+}
+
+func (h *typedHandler[Req, Resp]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req Req
+	if err := bindTyped(r, &req); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	resp, err := h.fn(r.Context(), req)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	status := http.StatusOK
+	if sc, ok := any(resp).(StatusCoder); ok {
+		status = sc.StatusCode()
+	}
+
+	Render(w, r, status, resp)
+}
+
+func bindTyped(r *http.Request, dst interface{}) error {
+	v := reflect.ValueOf(dst).Elem()
+
+	// allocate pointer request types so they can be bound into
+	if v.Kind() == reflect.Ptr {
+		v.Set(reflect.New(v.Type().Elem()))
+		dst = v.Interface()
+		v = v.Elem()
+	}
+
+	if v.Kind() == reflect.Struct {
+		return Bind(r, dst)
+	}
+
+	return DecodeJSON(r, dst)
+}
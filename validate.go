@@ -0,0 +1,327 @@
+package httpsrv
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RuleFunc checks v against the rule's param, e.g. "1" for min=1
+type RuleFunc func(v reflect.Value, param string) error
+
+var (
+	rulesMu sync.RWMutex
+	rules   = map[string]RuleFunc{
+		"required": ruleRequired,
+		"min":      ruleMin,
+		"max":      ruleMax,
+		"len":      ruleLen,
+		"oneof":    ruleOneOf,
+	}
+)
+
+// RegisterRule registers a validation rule available to Validate,
+// Bind and ReqValues.Rules under name
+func RegisterRule(name string, fn RuleFunc) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	rules[name] = fn
+}
+
+type rule struct {
+	name  string
+	param string
+	fn    RuleFunc
+}
+
+func (r rule) check(v reflect.Value) error {
+	return r.fn(v, r.param)
+}
+
+func parseRules(str string) ([]rule, error) {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+
+	var out []rule
+	for _, part := range strings.Split(str, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		var (
+			name  = part
+			param string
+		)
+
+		if i := strings.IndexByte(part, '='); i != -1 {
+			name, param = part[:i], part[i+1:]
+		}
+
+		fn, ok := rules[name]
+		if !ok {
+			return nil, fmt.Errorf("httpsrv: unknown validation rule %q", name)
+		}
+
+		out = append(out, rule{name: name, param: param, fn: fn})
+	}
+
+	return out, nil
+}
+
+// Validate checks every field of the struct pointed to by v against the
+// rules in its validate tag, e.g.
+//
+//	type listReq struct {
+//		Limit int    `query:"limit" validate:"min=1,max=100"`
+//		Sort  string `query:"sort" validate:"required,oneof=asc desc"`
+//	}
+//
+// The built in rules are required, min, max, len and oneof. min, max
+// and len compare numbers by value and strings, slices and maps by
+// length. Additional rules can be added with RegisterRule.
+//
+// Every failing field is reported in the returned ParamErrors.
+func Validate(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("httpsrv: Validate expects a struct, got %T", v)
+	}
+
+	var errs ParamErrors
+	if err := validateStruct(rv, "", nil, nil, &errs); err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// validateStruct checks the fields of v. When present is set, it holds
+// the request values that were bound, and required means the value was
+// present in the request rather than non-zero.
+func validateStruct(v reflect.Value, prefix string, skip, present map[string]bool, errs *ParamErrors) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		var (
+			f           = t.Field(i)
+			fv          = v.Field(i)
+			source, key = fieldName(f)
+		)
+
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+
+		if source == "body" {
+			key = prefix + key
+		}
+
+		if skip[source+":"+key] {
+			continue
+		}
+
+		if tag, ok := f.Tag.Lookup("validate"); ok && tag != "-" {
+			rs, err := parseRules(tag)
+			if err != nil {
+				return err
+			}
+
+			if present != nil && source != "body" {
+				rs = requirePresent(rs, present[source+":"+key])
+			}
+
+			if err := validateField(fv, rs); err != nil {
+				*errs = append(*errs, &ParamError{Source: source, Key: key, Value: fieldString(fv), Err: err})
+				continue
+			}
+		}
+
+		sv := reflect.Indirect(fv)
+		if sv.Kind() == reflect.Struct && sv.Type() != timeType {
+			p := prefix
+			if !f.Anonymous {
+				p = key + "."
+			}
+
+			if err := validateStruct(sv, p, skip, present, errs); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// requirePresent adapts rs to a request value. Present values are
+// checked against every rule but required, so zero values are allowed.
+// Absent values are only checked by required, like ReqValues.Rules.
+func requirePresent(rs []rule, present bool) []rule {
+	out := make([]rule, 0, len(rs))
+	for _, r := range rs {
+		switch {
+		case r.name != "required":
+			if present {
+				out = append(out, r)
+			}
+		case !present:
+			out = append(out, rule{name: r.name, fn: func(reflect.Value, string) error { return ErrMissingValue }})
+		}
+	}
+
+	return out
+}
+
+func validateField(v reflect.Value, rs []rule) error {
+	// optional pointers are only checked when set
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			for _, r := range rs {
+				if r.name == "required" {
+					return r.check(v)
+				}
+			}
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	for _, r := range rs {
+		if err := r.check(v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fieldName returns where in the request f is bound from and
+// the name it is bound with
+func fieldName(f reflect.StructField) (string, string) {
+	for _, src := range bindSources {
+		if key, ok := f.Tag.Lookup(src.tag); ok && key != "-" {
+			return src.tag, key
+		}
+	}
+
+	if tag, ok := f.Tag.Lookup("json"); ok {
+		if name := strings.Split(tag, ",")[0]; name != "" && name != "-" {
+			return "body", name
+		}
+	}
+
+	return "body", f.Name
+}
+
+func fieldString(v reflect.Value) string {
+	v = reflect.Indirect(v)
+	if !v.IsValid() {
+		return ""
+	}
+
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		return ""
+	}
+
+	return fmt.Sprint(v.Interface())
+}
+
+var errRuleType = errors.New("rule not supported for type")
+
+func ruleRequired(v reflect.Value, _ string) error {
+	if !v.IsValid() || v.IsZero() {
+		return ErrMissingValue
+	}
+
+	return nil
+}
+
+// size returns the value used by min, max and len
+func size(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+
+	return 0, false
+}
+
+func isLength(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return true
+	}
+
+	return false
+}
+
+func compareRule(v reflect.Value, param string, fn func(n, p float64) bool, numMsg, lenMsg string) error {
+	p, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return fmt.Errorf("invalid rule param %q", param)
+	}
+
+	n, ok := size(v)
+	if !ok {
+		return errRuleType
+	}
+
+	if fn(n, p) {
+		return nil
+	}
+
+	if isLength(v) {
+		return fmt.Errorf(lenMsg, param)
+	}
+
+	return fmt.Errorf(numMsg, param)
+}
+
+func ruleMin(v reflect.Value, param string) error {
+	return compareRule(v, param, func(n, p float64) bool { return n >= p },
+		"must be at least %s", "must have a length of at least %s")
+}
+
+func ruleMax(v reflect.Value, param string) error {
+	return compareRule(v, param, func(n, p float64) bool { return n <= p },
+		"must be at most %s", "must have a length of at most %s")
+}
+
+func ruleLen(v reflect.Value, param string) error {
+	return compareRule(v, param, func(n, p float64) bool { return n == p },
+		"must equal %s", "must have a length of %s")
+}
+
+func ruleOneOf(v reflect.Value, param string) error {
+	opts := strings.Fields(param)
+	s := fieldString(v)
+	for _, o := range opts {
+		if s == o {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("must be one of [%s]", strings.Join(opts, ", "))
+}